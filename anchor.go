@@ -0,0 +1,90 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 mock 锚点, 业务代码通过 anchor.At(name, args...) 定义具名的注入点,
+// 单测中通过 mock.Anchor(name).Apply(...) 或 .Panic(...) 在注入点注入行为。
+package mocker
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/tencent/goom/anchor"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// anchorCallerSkip 锚点调用的 callerskip, 用于 debug 日志定位到调用 anchor.At 的业务代码
+const anchorCallerSkip = 6
+
+// AnchorMocker 锚点 mocker
+type AnchorMocker struct {
+	*baseMocker
+	name    string
+	handler func(args ...interface{})
+}
+
+// NewAnchorMocker 创建锚点 mocker
+// pkgName 包路径
+// name 锚点名称
+func NewAnchorMocker(pkgName string, name string) *AnchorMocker {
+	return &AnchorMocker{
+		baseMocker: newBaseMocker(pkgName),
+		name:       name,
+	}
+}
+
+// String mock 的名称或描述
+func (m *AnchorMocker) String() string {
+	return "anchor:" + m.name
+}
+
+// Apply 指定锚点执行的回调函数
+// callback 的签名为 func(args ...interface{}) 或 func()
+func (m *AnchorMocker) Apply(callback interface{}) {
+	switch f := callback.(type) {
+	case func(args ...interface{}):
+		m.doApply(f)
+	case func():
+		m.doApply(func(...interface{}) { f() })
+	default:
+		panic(fmt.Sprintf("anchor callback must be func(args ...interface{}) or func(), actual %T",
+			callback))
+	}
+}
+
+// Panic 执行到锚点时抛出 panic
+func (m *AnchorMocker) Panic(v interface{}) {
+	m.doApply(func(...interface{}) {
+		panic(v)
+	})
+}
+
+// doApply 设置锚点的注入行为并激活锚点
+func (m *AnchorMocker) doApply(handler func(args ...interface{})) {
+	m.handler = handler
+	m.activate()
+	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(6), m.String())
+}
+
+// Cancel 取消锚点的注入行为, 并清理调用记录等 mocker 的公共状态
+func (m *AnchorMocker) Cancel() {
+	anchor.Deactivate(m.name, m)
+	m.baseMocker.Cancel()
+}
+
+// activate 激活锚点, 同名的锚点以最后激活的为准
+func (m *AnchorMocker) activate() {
+	anchor.Activate(m.name, m, m.invoke)
+	m.canceled = false
+}
+
+// invoke 执行锚点的注入行为并记录调用
+func (m *AnchorMocker) invoke(args ...interface{}) {
+	params := make([]reflect.Value, len(args))
+	for i := range args {
+		params[i] = reflect.ValueOf(&args[i]).Elem()
+	}
+	recordCall(m, m.callRecorder, false, anchorCallerSkip, params, func([]reflect.Value) []reflect.Value {
+		m.handler(args...)
+		return nil
+	})
+}
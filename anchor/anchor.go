@@ -0,0 +1,82 @@
+// Package anchor 定义了业务代码中使用的具名 mock 锚点。
+// 锚点包只依赖标准库, 业务代码引入锚点不会引入 mocker 包及其依赖(内存探测、信号处理、yaml 等),
+// 单测中通过 mock.Anchor(name).Apply(...) 或 .Panic(...) 激活锚点并注入行为。
+// 锚点定义在独立的 anchor.At 而不是 mocker 包中: 被测代码需要在生产代码中引用锚点,
+// mocker 包的单测又需要引用被测代码(比如 goom/test), 放在 mocker 包中会产生循环引用。
+package anchor
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// points 已激活的锚点, 同名的锚点按照激活的顺序入栈, 栈顶的锚点生效
+	points = make(map[string][]*point)
+	lock   sync.RWMutex
+	// active 已激活的锚点数量, 为 0 时 At 直接返回
+	active int32
+)
+
+// point 已激活的锚点
+type point struct {
+	owner   interface{}
+	handler func(args ...interface{})
+}
+
+// At 定义具名的 mock 锚点, 在业务代码中使用, 没有激活的锚点时不执行任何操作
+// name 锚点名称, 建议使用 模块.位置 的格式, 比如: payment.beforeCommit
+// args 传递给注入行为的参数
+func At(name string, args ...interface{}) {
+	if atomic.LoadInt32(&active) == 0 {
+		return
+	}
+	lock.RLock()
+	var p *point
+	if stack := points[name]; len(stack) > 0 {
+		p = stack[len(stack)-1]
+	}
+	lock.RUnlock()
+	if p != nil {
+		p.handler(args...)
+	}
+}
+
+// Activate 激活锚点, 同名的锚点以最后激活的为准, 取消之后恢复为之前激活的锚点
+// owner 激活锚点的对象, 同一个 owner 重新激活时移动到栈顶
+func Activate(name string, owner interface{}, handler func(args ...interface{})) {
+	lock.Lock()
+	defer lock.Unlock()
+	stack, ok := points[name]
+	if !ok {
+		atomic.AddInt32(&active, 1)
+	}
+	stack = remove(stack, owner)
+	points[name] = append(stack, &point{owner: owner, handler: handler})
+}
+
+// Deactivate 取消 owner 激活的锚点, 之前激活的锚点重新生效; 其他 owner 激活的锚点不受影响
+func Deactivate(name string, owner interface{}) {
+	lock.Lock()
+	defer lock.Unlock()
+	stack, ok := points[name]
+	if !ok {
+		return
+	}
+	if stack = remove(stack, owner); len(stack) > 0 {
+		points[name] = stack
+		return
+	}
+	delete(points, name)
+	atomic.AddInt32(&active, -1)
+}
+
+// remove 从锚点栈中移除 owner 激活的锚点, 返回新的栈, 不修改原来的栈
+func remove(stack []*point, owner interface{}) []*point {
+	for i, p := range stack {
+		if p.owner == owner {
+			return append(stack[:i:i], stack[i+1:]...)
+		}
+	}
+	return stack
+}
@@ -0,0 +1,34 @@
+package arg
+
+import (
+	"reflect"
+
+	"github.com/tencent/goom/erro"
+)
+
+// CastValue 显式强制转换的值, 适用于结构体 fake 场景
+// 比如: 使用与被 mock 函数返回值结构相同的 fake 结构体作为返回值
+type CastValue struct {
+	value interface{}
+}
+
+// Cast 将 value 按照内存布局强制转换为参数或返回值的类型
+// value 的类型大小必须和目标类型一致, 调用方需要保证两者的内存布局相同
+func Cast(value interface{}) *CastValue {
+	return &CastValue{value: value}
+}
+
+// to 强制转换为 out 类型
+func (c *CastValue) to(out reflect.Type) (reflect.Value, error) {
+	if c.value == nil {
+		return toValue(nil, out)
+	}
+	v := reflect.ValueOf(c.value)
+	if v.Type() == out {
+		return v, nil
+	}
+	if v.Type().Size() != out.Size() || v.Kind() != out.Kind() {
+		return reflect.Value{}, erro.NewValueNotMatchError(out, v.Type(), "size or kind of the cast value not match")
+	}
+	return cast(v, out), nil
+}
@@ -0,0 +1,113 @@
+package arg
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/tencent/goom/erro"
+)
+
+// OutArg 出参写入定义, 在 mock 返回结果前通过反射将值写入指针参数所指向的内存
+// 适用于 func Load(key string, out *Config) error 或 json.Unmarshal 这类通过指针参数回填结果的函数
+type OutArg struct {
+	// index 参数下标(不含方法接收体)
+	index int
+	// field 属性名, 为空时写入整个值
+	field string
+	// value 写入的值
+	value interface{}
+	// valueV 解析后的写入值, 参数类型为 interface{} 时只能在调用时解析
+	valueV reflect.Value
+}
+
+// SetArg 创建出参写入定义, 将 value 写入第 index 个参数指向的值
+func SetArg(index int, value interface{}) *OutArg {
+	return &OutArg{index: index, value: value}
+}
+
+// SetField 创建出参属性写入定义, 将 value 写入第 index 个参数指向的结构体的 name 属性
+func SetField(index int, name string, value interface{}) *OutArg {
+	return &OutArg{index: index, field: name, value: value}
+}
+
+// Resolve 解析参数类型, 并对写入值进行类型检查
+func (o *OutArg) Resolve(types []reflect.Type) error {
+	if o.index < 0 || o.index >= len(types) {
+		return fmt.Errorf("SetArg index out of range, index: %d, args length: %d", o.index, len(types))
+	}
+
+	typ := types[o.index]
+	switch typ.Kind() {
+	case reflect.Ptr:
+		v, err := o.resolveValue(typ.Elem())
+		if err != nil {
+			return err
+		}
+		o.valueV = v
+		return nil
+	case reflect.Interface:
+		// interface{} 类型的参数只能在调用时确定实际类型
+		return nil
+	default:
+		return fmt.Errorf("SetArg requires a pointer param, index: %d, actual: %s", o.index, typ)
+	}
+}
+
+// Apply 将值写入参数指向的内存
+// args 调用参数(不含方法接收体)
+func (o *OutArg) Apply(args []reflect.Value) error {
+	if o.index >= len(args) {
+		return fmt.Errorf("SetArg index out of range, index: %d, args length: %d", o.index, len(args))
+	}
+
+	ptr := args[o.index]
+	if ptr.Kind() == reflect.Interface {
+		ptr = ptr.Elem()
+	}
+	if !ptr.IsValid() || ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return fmt.Errorf("SetArg requires a non-nil pointer param, index: %d", o.index)
+	}
+
+	v := o.valueV
+	if !v.IsValid() {
+		var err error
+		if v, err = o.resolveValue(ptr.Type().Elem()); err != nil {
+			return err
+		}
+	}
+
+	target := ptr.Elem()
+	if o.field != "" {
+		target = target.FieldByName(o.field)
+	}
+	if !target.CanSet() {
+		// 未导出属性通过地址绕过可写检查
+		target = reflect.NewAt(target.Type(), unsafe.Pointer(target.UnsafeAddr())).Elem()
+	}
+	target.Set(v)
+	return nil
+}
+
+// resolveValue 将写入值转换为指针指向的类型(或其属性类型)
+func (o *OutArg) resolveValue(elem reflect.Type) (reflect.Value, error) {
+	typ := elem
+	if o.field != "" {
+		if elem.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("SetArgField requires a struct pointer param, index: %d, actual: *%s",
+				o.index, elem)
+		}
+		f, ok := elem.FieldByName(o.field)
+		if !ok {
+			return reflect.Value{}, erro.NewFieldNotFoundError(elem.String(), o.field)
+		}
+		typ = f.Type
+	}
+
+	value := o.value
+	// 允许直接传入同类型的指针
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.Type().Elem() == typ && !v.IsNil() {
+		value = v.Elem().Interface()
+	}
+	return toValue(value, typ)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"unsafe"
 
+	"github.com/tencent/goom/erro"
 	"github.com/tencent/goom/internal/hack"
 	"github.com/tencent/goom/internal/iface"
 )
@@ -21,37 +22,133 @@ func I2V(objs []interface{}, types []reflect.Type) ([]reflect.Value, error) {
 	for i, a := range objs {
 		values[i], e = toValue(a, types[i])
 		if e != nil {
-			return nil, e
+			return nil, withIndex(e, i)
 		}
 	}
 	return values, nil
 }
 
 // toValue 将interface参数值转化为reflect.Value值
+// 转换顺序: 可赋值 -> 可转换(按照 Go 的类型转换规则) -> 显式强制转换(通过 arg.Cast 指定)
 func toValue(r interface{}, out reflect.Type) (reflect.Value, error) {
+	if c, ok := r.(*CastValue); ok {
+		return c.to(out)
+	}
+
+	if r == nil {
+		if !isNilable(out.Kind()) {
+			return reflect.Value{}, erro.NewValueNotMatchError(out, nil, "nil is not allowed")
+		}
+		return reflect.Zero(out), nil
+	}
+
 	v := reflect.ValueOf(r)
-	if r != nil && v.Type() != out && (out.Kind() == reflect.Struct || out.Kind() == reflect.Ptr) {
-		if v.Type().Size() != out.Size() {
-			return reflect.Value{}, fmt.Errorf("The type of the args does not match, required: %s, actual: %v", out, v.Type())
+	if ctx, ok := r.(*iface.IContext); ok && out.Kind() == reflect.Interface && out.NumMethod() > 0 {
+		return toIface(ctx, out)
+	}
+	if v.Type() == out {
+		return v, nil
+	}
+
+	if v.Type().AssignableTo(out) {
+		if out.Kind() == reflect.Interface {
+			ptr := reflect.New(out)
+			ptr.Elem().Set(v)
+			return ptr.Elem(), nil
+		}
+		return v.Convert(out), nil
+	}
+
+	if isNumber(v.Kind()) && isNumber(out.Kind()) {
+		if isFloat(v.Kind()) && !isFloat(out.Kind()) {
+			return reflect.Value{}, erro.NewValueNotMatchError(out, v.Type(), "float can not be converted to integer")
 		}
-		// 类型强制转换,适用于结构体 fake 场景
-		v = cast(v, out)
-	}
-
-	if r == nil && (out.Kind() == reflect.Interface || out.Kind() == reflect.Ptr || out.Kind() == reflect.Slice ||
-		out.Kind() == reflect.Map || out.Kind() == reflect.Array || out.Kind() == reflect.Chan) {
-		v = reflect.Zero(reflect.SliceOf(out).Elem())
-	} else if v.Type().Kind() == reflect.Ptr &&
-		v.Type() == reflect.TypeOf(&iface.IContext{}) {
-		panic("goom not support Return() API when returns mocked interface type, please use Apply() API instead.")
-	} else if r != nil && out.Kind() == reflect.Interface {
-		ptr := reflect.New(out)
-		ptr.Elem().Set(v)
-		v = ptr.Elem()
-	} else if v.Type().Size() != out.Size() {
-		return reflect.Value{}, fmt.Errorf("The type of the args does not match, required: %s, actual: %v", out, v.Type())
-	}
-	return v, nil
+		return convertNumber(v, out)
+	}
+
+	// 切片转换为数组或者数组指针时, 切片长度小于数组长度会 panic
+	if n, ok := arrayLen(out); ok && v.Kind() == reflect.Slice && v.Len() < n {
+		return reflect.Value{}, erro.NewValueNotMatchError(out, v.Type(),
+			fmt.Sprintf("slice length %d is less than array length %d", v.Len(), n))
+	}
+	// 整型转换为 string 是按照 rune 转换的, 通常不是期望的行为
+	if v.Type().ConvertibleTo(out) && !(isNumber(v.Kind()) && out.Kind() == reflect.String) {
+		return v.Convert(out), nil
+	}
+	return reflect.Value{}, erro.NewValueNotMatchError(out, v.Type(), "use arg.Cast(v) to force cast a fake struct")
+}
+
+// toIface 将 mock 的接口变量转换为接口类型的值
+// mock 的接口变量赋值给 interface{} 时会丢失伪造的方法表, 需要从上下文中找回
+func toIface(ctx *iface.IContext, out reflect.Type) (reflect.Value, error) {
+	fake, ok := ctx.Fake(out)
+	if !ok {
+		return reflect.Value{}, erro.NewValueNotMatchError(out, reflect.TypeOf(ctx),
+			"the mocked interface is canceled or is not a "+out.String())
+	}
+	ptr := reflect.New(out)
+	*(*hack.Iface)(unsafe.Pointer(ptr.Pointer())) = *fake
+	return ptr.Elem(), nil
+}
+
+// arrayLen 数组或者数组指针类型的数组长度
+func arrayLen(typ reflect.Type) (int, bool) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Array {
+		return 0, false
+	}
+	return typ.Len(), true
+}
+
+// isNilable 是否为可以为 nil 的类型
+func isNilable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFloat 是否为浮点类型
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// isNumber 是否为数值类型
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// convertNumber 按照 Go 的类型转换规则转换数值类型, 比如将常量 1(int) 转换为 int64 或 uint32
+// 转换为整数时数值发生溢出或精度丢失时返回错误, 转换为浮点数时只检查是否超出范围, 比如 0.1 可以转换为 float32
+func convertNumber(v reflect.Value, out reflect.Type) (reflect.Value, error) {
+	newV := v.Convert(out)
+	var lossy bool
+	if isFloat(out.Kind()) {
+		// 浮点数之间转换允许精度丢失, 只有超出 float32 的范围时才是溢出
+		lossy = out.Kind() == reflect.Float32 && isFloat(v.Kind()) &&
+			!math.IsInf(v.Float(), 0) && math.Abs(v.Float()) > math.MaxFloat32
+	} else {
+		// 转换回原类型后不相等, 说明发生了溢出或者精度丢失
+		lossy = newV.Convert(v.Type()).Interface() != v.Interface() && !(isFloat(v.Kind()) && math.IsNaN(v.Float()))
+	}
+	// 负数不能转换为无符号类型
+	negative := v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 &&
+		out.Kind() >= reflect.Uint && out.Kind() <= reflect.Uintptr && v.Int() < 0
+	if lossy || negative {
+		return reflect.Value{}, erro.NewValueNotMatchError(out, v.Type(), fmt.Sprintf("value %v overflows", v.Interface()))
+	}
+	return newV, nil
 }
 
 // cast 将reflect.Value类型强制转换为执行type类型的reflect.Value
@@ -110,7 +207,7 @@ func ToExpr(args []interface{}, types []reflect.Type) ([]Expr, error) {
 		}
 		err := expressions[i].Resolve([]reflect.Type{types[i]})
 		if err != nil {
-			return nil, err
+			return nil, withIndex(err, i)
 		}
 	}
 	return expressions, nil
@@ -153,3 +250,11 @@ func isZero(v reflect.Value) bool {
 		return true
 	}
 }
+
+// withIndex 给类型不匹配异常添加参数下标
+func withIndex(err error, index int) error {
+	if e, ok := err.(*erro.ValueNotMatch); ok {
+		return e.At(index)
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了批量应用 mock, 支持了 mock.Batch(func(b *Builder){...}),
+// 批量应用的 patch 指令按照内存页分组统一写入, 任意一个 mock 失败时回滚批量中创建的所有 mock,
+// 并把批量之前已经存在的函数和方法 mock 恢复为批量之前的状态。
+package mocker
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"github.com/tencent/goom/erro"
+	"github.com/tencent/goom/internal/patch"
+)
+
+// snapshotter 支持回滚批量应用中修改的 mocker
+type snapshotter interface {
+	// snapshot 保存当前状态, 返回恢复的函数
+	snapshot() func()
+}
+
+// Batch 批量应用 fn 中的 mock, fn 返回之后按照内存页分组统一写入 patch 的指令, 每个内存页只修改一次权限
+// fn 中的 mock 在 Batch 返回之后才生效; fn 中任意一个 mock 失败(panic)或者写入失败时,
+// 取消 fn 中创建的所有 mock, 已经存在的函数和方法 mock 恢复为 Batch 之前的条件和返回值, 再重新 panic,
+// 被 patch 的函数保持 Batch 之前的状态; 接口和变量的 mock 不涉及 patch 指令, fn 中对已经存在的接口和变量 mock 的修改不回滚
+func (b *Builder) Batch(fn func(b *Builder)) *Builder {
+	if !patch.BeginBatch() {
+		// 嵌套的 Batch 由最外层统一提交
+		fn(b)
+		return b
+	}
+	existing := make(map[Mocker]bool, len(b.mockers))
+	restores := make([]func(), 0, len(b.mockers))
+	for _, key := range b.order {
+		m := b.mockers[key]
+		existing[m] = true
+		if s, ok := m.(snapshotter); ok && !m.Canceled() {
+			restores = append(restores, s.snapshot())
+		}
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			b.rollback(existing)
+			restoreAll(restores)
+			patch.RollbackBatch()
+			panic(e)
+		}
+	}()
+	fn(b)
+	if err := patch.CommitBatch(); err != nil {
+		panic(erro.NewTraceableErrorc("batch patch commit error", err))
+	}
+	return b
+}
+
+// rollback 按照创建的逆序取消批量中创建的 mock
+func (b *Builder) rollback(existing map[Mocker]bool) {
+	for i := len(b.order) - 1; i >= 0; i-- {
+		if m := b.mockers[b.order[i]]; !existing[m] && !m.Canceled() {
+			m.Cancel()
+		}
+	}
+}
+
+// restoreAll 按照保存的逆序恢复
+func restoreAll(restores []func()) {
+	for i := len(restores) - 1; i >= 0; i-- {
+		restores[i]()
+	}
+}
+
+// snapshot 保存 mocker 应用的实现、条件和拦截层, 恢复时取消之后添加的拦截层, 实现被替换时重新应用之前的实现
+func (m *baseMocker) snapshot() func() {
+	guard, imp, origin, funcDef, when, target := m.guard, m.imp, m.origin, m.funcDef, m.when, m.patched
+	if g, ok := guard.(*hubMockGuard); ok && origin == g.hub.origin {
+		// 分发函数的跳板函数在取消之后可能被回收, 重新应用时重新获取
+		origin = nil
+	}
+	layers := len(m.layers)
+	var restoreWhen func()
+	if when != nil {
+		restoreWhen = when.snapshot()
+	}
+	return func() {
+		if m.canceled {
+			return
+		}
+		for _, l := range m.layers[layers:] {
+			l.Cancel()
+		}
+		m.layers = m.layers[:layers]
+		if m.guard != guard {
+			switch {
+			case guard == nil:
+				m.guard.Cancel()
+				m.guard = nil
+			case target.patch != nil:
+				m.origin = origin
+				m.applyPatch(target, imp)
+			}
+		}
+		m.imp, m.funcDef, m.when = imp, funcDef, when
+		if restoreWhen != nil {
+			restoreWhen()
+		}
+	}
+}
+
+// snapshot 保存条件和返回值, 不恢复已经匹配的次数
+func (w *When) snapshot() func() {
+	saved := *w
+	restores := make([]func(), 0, len(w.matches)+1)
+	for _, c := range append(w.matches[:len(w.matches):len(w.matches)], w.defaultReturns) {
+		if s, ok := c.(snapshotter); ok && !reflect.ValueOf(c).IsNil() {
+			restores = append(restores, s.snapshot())
+		}
+	}
+	return func() {
+		*w = saved
+		restoreAll(restores)
+	}
+}
+
+// snapshot 保存条件的返回值、出参和状态条件等, 不恢复已经匹配的次数
+func (c *BaseMatcher) snapshot() func() {
+	saved := *c
+	return func() {
+		saved.curNum = atomic.LoadInt32(&c.curNum)
+		saved.hits = atomic.LoadInt64(&c.hits)
+		*c = saved
+	}
+}
+
+// snapshot 保存所有方法的 mock, 恢复时取消之后新增的方法 mock
+func (m *CachedMethodMocker) snapshot() func() {
+	mCache := make(map[string]*MethodMocker, len(m.mCache))
+	umCache := make(map[string]UnExportedMocker, len(m.umCache))
+	restores := make([]func(), 0, len(m.mCache)+len(m.umCache))
+	for name, v := range m.mCache {
+		mCache[name] = v
+		restores = append(restores, v.snapshot())
+	}
+	for name, v := range m.umCache {
+		umCache[name] = v
+		if s, ok := v.(snapshotter); ok {
+			restores = append(restores, s.snapshot())
+		}
+	}
+	return func() {
+		for name, v := range m.mCache {
+			if mCache[name] != v {
+				v.Cancel()
+				delete(m.mCache, name)
+			}
+		}
+		for name, v := range m.umCache {
+			if umCache[name] != v {
+				v.Cancel()
+				delete(m.umCache, name)
+			}
+		}
+		restoreAll(restores)
+	}
+}
+
+// snapshot 保存所有未导出方法的 mock, 恢复时取消之后新增的方法 mock
+func (m *CachedUnexportedMethodMocker) snapshot() func() {
+	mockers := make(map[string]*UnexportedMethodMocker, len(m.mockers))
+	restores := make([]func(), 0, len(m.mockers))
+	for name, v := range m.mockers {
+		mockers[name] = v
+		restores = append(restores, v.snapshot())
+	}
+	return func() {
+		for name, v := range m.mockers {
+			if mockers[name] != v {
+				v.Cancel()
+				delete(m.mockers, name)
+			}
+		}
+		restoreAll(restores)
+	}
+}
+
+// snapshot 接口的 mock 不涉及 patch 指令, 不回滚
+func (m *CachedInterfaceMocker) snapshot() func() {
+	return func() {}
+}
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/tencent/goom/internal/iface"
 	"github.com/tencent/goom/internal/logger"
@@ -18,6 +19,24 @@ import (
 type Builder struct {
 	pkgName string
 	mockers map[interface{}]Mocker
+	// order mocker 的创建顺序, Reset 时按照逆序取消
+	order []interface{}
+	// states 命名状态, 同一个 builder 内的 mocker 共享
+	states map[string]*State
+	// partialReturn 是否允许只指定部分返回值
+	partialReturn bool
+	// callLog 调用日志, 同一个 builder 内的 mocker 共享
+	callLog *callLog
+	// tracePath 调用日志导出的文件路径, 为空时不导出
+	tracePath string
+	// traceFormat 调用日志导出的格式
+	traceFormat TraceFormat
+	// reportUnused Reset 时是否打印从未被调用的 mocker 和条件
+	reportUnused bool
+	// scope mock 的作用域, 为 nil 时 mock 全局生效
+	scope *mockScope
+	// inflightTimeout 取消 mock 时等待进行中的调用结束的超时时间
+	inflightTimeout time.Duration
 }
 
 // Pkg 指定包名，当前包无需指定
@@ -40,10 +59,7 @@ func (b *Builder) PkgName() string {
 func New() *Builder {
 	// callerDeps 当前的调用栈栈层次
 	const callerDeps = 2
-	return &Builder{
-		pkgName: currentPkg(callerDeps),
-		mockers: make(map[interface{}]Mocker, 30),
-	}
+	return newBuilder(currentPkg(callerDeps))
 }
 
 // Create 创建 Mock 构建器
@@ -51,9 +67,16 @@ func New() *Builder {
 func Create() *Builder {
 	// callerDeps 当前的调用栈栈层次
 	const callerDeps = 2
+	return newBuilder(currentPkg(callerDeps))
+}
+
+// newBuilder 创建指定包路径的 Mock 构建器
+func newBuilder(pkgName string) *Builder {
 	return &Builder{
-		pkgName: currentPkg(callerDeps),
+		pkgName: pkgName,
 		mockers: make(map[interface{}]Mocker, 30),
+		states:  make(map[string]*State),
+		callLog: &callLog{},
 	}
 }
 
@@ -77,7 +100,32 @@ func (b *Builder) Interface(iFace interface{}) *CachedInterfaceMocker {
 
 // cache 添加到缓存
 func (b *Builder) cache(mKey interface{}, cachedMocker Mocker) {
+	if m, ok := cachedMocker.(binder); ok {
+		m.bind(b)
+	}
 	b.mockers[mKey] = cachedMocker
+	// 取消之后重新创建的 mocker 移到末尾
+	for i, k := range b.order {
+		if k == mKey {
+			b.order = append(b.order[:i:i], b.order[i+1:]...)
+			break
+		}
+	}
+	b.order = append(b.order, mKey)
+	b.register()
+}
+
+// binder 可绑定构建器的 mocker
+type binder interface {
+	bind(b *Builder)
+}
+
+// AllowPartialReturn 允许 Return 只指定前面部分的返回值, 未指定的返回值使用零值
+// 默认情况下 Return 的返回值个数必须和函数返回值个数一致
+// 比如: mock.AllowPartialReturn().Func(foo).Return(1) // foo 的其余返回值为零值
+func (b *Builder) AllowPartialReturn() *Builder {
+	b.partialReturn = true
+	return b
 }
 
 // Struct 指定结构体实例
@@ -157,6 +205,21 @@ func (b *Builder) ExportFunc(name string) *UnexportedFuncMocker {
 	return mocker
 }
 
+// Anchor 指定 mock 锚点, 锚点通过 anchor.At(name, args...) 在业务代码中定义
+// 比如: mock.Anchor("payment.beforeCommit").Panic("commit failed")
+func (b *Builder) Anchor(name string) *AnchorMocker {
+	mKey := "anchor:" + name
+	if mocker, ok := b.mockers[mKey]; ok && !mocker.Canceled() {
+		b.reset2CurPkg()
+		return mocker.(*AnchorMocker)
+	}
+
+	mocker := NewAnchorMocker(b.pkgName, name)
+	b.cache(mKey, mocker)
+	b.reset2CurPkg()
+	return mocker
+}
+
 // Var 变量 mock, target 类型必须传递指针类型
 func (b *Builder) Var(v interface{}) VarMock {
 	cacheKey := fmt.Sprintf("var_%d", reflect.ValueOf(v).Pointer())
@@ -188,14 +251,34 @@ func (b *Builder) UnExportedVar(path string) UnExportedVarMock {
 	return mocker
 }
 
-// Reset 取消当前 builder 的所有 Mock
+// State 获取命名状态, 同一个 builder 内相同名称返回同一个状态
+// 比如: mock.State("conn").Init("up")
+// mock.Func(Send).When(arg.Any()).InState("conn", "up").Return(nil)
+// mock.Interface(&c).Method("Close").Return(nil).InState("conn", "up").Transition("conn", "down")
+func (b *Builder) State(name string) *State {
+	if st, ok := b.states[name]; ok {
+		return st
+	}
+	st := newState(name)
+	b.states[name] = st
+	return st
+}
+
+// Reset 取消当前 builder 的所有 Mock, 按照创建的逆序取消
 func (b *Builder) Reset() *Builder {
-	for _, mocker := range b.mockers {
+	b.reportUsage()
+	for i := len(b.order) - 1; i >= 0; i-- {
+		mocker := b.mockers[b.order[i]]
 		mocker.Cancel()
 		// callerDeps 当前的调用栈栈层次
 		const callerDeps = 5
 		logger.Consolefc(logger.DebugLevel, "mockers [%s] resets.", logger.Caller(callerDeps), mocker.String())
 	}
+	for _, st := range b.states {
+		st.reset()
+	}
+	b.unregister()
+	b.exportTrace()
 	return b
 }
 
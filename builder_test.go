@@ -115,3 +115,28 @@ func (s *builderTestSuite) Test_currentPkg() {
 
 // fake 模拟函数
 func fake() {}
+
+func (s *builderTestSuite) Test_isInternalFrame() {
+	tests := []struct {
+		name     string
+		function string
+		want     bool
+	}{
+		{name: "mocker package", function: "github.com/tencent/goom.(*Builder).Func", want: true},
+		{name: "arg package", function: "github.com/tencent/goom/arg.ToExpr", want: true},
+		{name: "internal package", function: "github.com/tencent/goom/internal/patch.(*Guard).Apply", want: true},
+		{name: "reflect", function: "reflect.Value.call", want: true},
+		{name: "test package", function: "github.com/tencent/goom/test.Foo", want: false},
+		{name: "external test package", function: "github.com/tencent/goom_test.(*mockerTestSuite).TestUnitUsage",
+			want: false},
+		{name: "package with same prefix", function: "github.com/tencent/goomx/svc.Handle", want: false},
+		{name: "package under module path", function: "github.com/tencent/goom/tool/gen.Run", want: false},
+		{name: "generic func", function: "github.com/tencent/goom/test.Map[...]", want: false},
+		{name: "generic type arg", function: "example.com/svc.Do[github.com/tencent/goom.Builder]", want: false},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.Equal(tt.want, isInternalFrame(tt.function))
+		})
+	}
+}
@@ -39,11 +39,12 @@ func (m *CachedMethodMocker) String() string {
 }
 
 // Method 设置结构体的方法名
-func (m *CachedMethodMocker) Method(name string) ExportedMocker {
+func (m *CachedMethodMocker) Method(name string) FuncMocker {
 	if mocker, ok := m.mCache[name]; ok && !mocker.Canceled() {
 		return mocker
 	}
 	mocker := NewMethodMocker(m.pkgName, m.MethodMocker.structDef)
+	mocker.bind(m.builder)
 	mocker.Method(name)
 	m.mCache[name] = mocker
 	return mocker
@@ -55,6 +56,7 @@ func (m *CachedMethodMocker) ExportMethod(name string) UnExportedMocker {
 		return mocker
 	}
 	mocker := NewMethodMocker(m.pkgName, m.MethodMocker.structDef)
+	mocker.bind(m.builder)
 	exportedMocker := mocker.ExportMethod(name)
 	m.umCache[name] = exportedMocker
 	return exportedMocker
@@ -99,6 +101,7 @@ func (m *CachedUnexportedMethodMocker) Method(name string) UnExportedMocker {
 		return mocker
 	}
 	mocker := NewUnexportedMethodMocker(m.pkgName, m.UnexportedMethodMocker.structName)
+	mocker.bind(m.builder)
 	mocker.Method(name)
 	m.mockers[name] = mocker
 	return mocker
@@ -142,6 +145,7 @@ func (m *CachedInterfaceMocker) Method(name string) InterfaceMocker {
 		return mocker
 	}
 	mocker := NewDefaultInterfaceMocker(m.pkgName, m.iFace, m.ctx)
+	mocker.bind(m.builder)
 	mocker.Method(name)
 	m.mockers[name] = mocker
 	return mocker
@@ -0,0 +1,452 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 mock 调用记录, 记录每次调用的参数、返回值、panic、耗时和协程,
+// 支持了 mocker.Times()、mocker.CalledWith(XXX) 等调用校验, 以及 mocker.WaitCalled(ctx, n) 等异步调用的等待。
+package mocker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/internal/hack"
+	"github.com/tencent/goom/internal/iface"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// Call 一次调用的记录
+type Call struct {
+	// Receiver 方法的接收体, 接口 mock 时为*IContext, 函数调用时为 nil
+	Receiver interface{}
+	// Args 调用参数(不含接收体)
+	Args []interface{}
+	// Results 返回值, 发生 panic 时为 nil
+	Results []interface{}
+	// Panic 调用过程中发生的 panic
+	Panic interface{}
+	// Time 调用开始时间
+	Time time.Time
+	// Duration 调用耗时
+	Duration time.Duration
+	// Goroutine 调用所在的协程 id, 仅在 Spy、Record 或者导出调用日志时记录
+	Goroutine int64
+	// Seq 调用序号, 所有 mocker 共享全局递增的序号, 用于校验调用顺序
+	Seq int64
+	// Mocker 被调用的 mocker 名称
+	Mocker string
+	// Caller 调用方的代码位置, 格式为 file:line, 仅在 Spy、Record 或者导出调用日志时记录
+	Caller string
+
+	// args 调用参数, 用于参数匹配
+	args []reflect.Value
+	// results 返回值, 用于导出调用日志
+	results []reflect.Value
+}
+
+// Recorder 调用记录查询接口
+// 未开启 Spy 或 Record 的 mocker 只保留最近 256 次调用记录, Times 仍然统计全部调用次数
+type Recorder interface {
+	// Invocations 所有的调用记录
+	Invocations() []*Call
+	// Times 调用次数
+	Times() int
+	// CalledWith 是否有调用的参数符合条件, 参数条件同 When
+	CalledWith(specArgOrExpr ...interface{}) bool
+	// WaitCalled 等待调用次数达到 n 次, ctx 结束时返回错误
+	WaitCalled(ctx context.Context, n int) error
+	// Calls 订阅调用记录, 先推送已有的调用, 之后每次调用完成时推送
+	Calls() <-chan Call
+	// EventuallyCalled 在 timeout 内调用次数达到 n 次, 超时时通过 t 报告错误并返回 false
+	EventuallyCalled(t TestingT, timeout time.Duration, n int) bool
+	// EventuallyCalledWith 在 timeout 内有调用的参数符合条件, 超时时通过 t 报告错误并返回 false
+	EventuallyCalledWith(t TestingT, timeout time.Duration, specArgOrExpr ...interface{}) bool
+}
+
+// callSeq 全局调用序号, 所有 mocker 共享, 不同 Builder 的 mocker 之间同样可以校验调用顺序
+var callSeq int64
+
+const (
+	// callsBuffer Calls() 订阅通道的缓冲大小, 缓冲满时丢弃新的调用记录
+	callsBuffer = 1024
+	// recentCalls 未开启 Spy 或 Record 的 mocker 保留的最近调用记录数量, 超过之后丢弃最早的记录
+	recentCalls = 256
+)
+
+// callRecorder 调用记录器
+type callRecorder struct {
+	calls []*Call
+	lock  sync.Mutex
+	// total 累计调用次数, 包含已经丢弃的调用记录
+	total int
+	// full 保留全部调用记录, 并记录调用所在的协程和调用方的代码位置, Spy 和 Record 时开启
+	full bool
+	// changed 每次添加调用记录时关闭并重建, 用于通知等待者
+	changed chan struct{}
+	// subscribers Calls() 的订阅者
+	subscribers []chan Call
+	// closed mocker 取消之后关闭订阅通道, 之后的订阅推送已有的调用之后立即关闭
+	closed bool
+	// log 绑定 Builder 后, 调用记录同时写入 Builder 的调用日志
+	log *callLog
+	// active 进行中的调用
+	active inflight
+}
+
+// newCallRecorder 创建调用记录器
+func newCallRecorder() *callRecorder {
+	return &callRecorder{
+		changed: make(chan struct{}),
+	}
+}
+
+// nextSeq 获取下一个调用序号
+func (r *callRecorder) nextSeq() int64 {
+	return atomic.AddInt64(&callSeq, 1)
+}
+
+// keepAll 保留全部调用记录
+func (r *callRecorder) keepAll() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.full = true
+}
+
+// detailed 是否需要记录调用所在的协程和调用方的代码位置
+func (r *callRecorder) detailed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.full || (r.log != nil && r.log.enabled())
+}
+
+// add 添加调用记录
+func (r *callRecorder) add(c *Call) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.total++
+	r.calls = append(r.calls, c)
+	if !r.full && len(r.calls) > recentCalls {
+		r.calls[0] = nil
+		r.calls = r.calls[1:]
+	}
+	if r.log != nil {
+		r.log.add(c)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+	for _, ch := range r.subscribers {
+		select {
+		case ch <- *c:
+		default:
+			logger.Consolef(logger.WarningLevel, "calls channel is full, call #%d dropped", c.Seq)
+		}
+	}
+}
+
+// Invocations 保留的调用记录
+func (r *callRecorder) Invocations() []*Call {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	calls := make([]*Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// Times 调用次数
+func (r *callRecorder) Times() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.total
+}
+
+// CalledWith 是否有调用的参数符合条件
+func (r *callRecorder) CalledWith(specArgOrExpr ...interface{}) bool {
+	for _, c := range r.Invocations() {
+		if matchCall(c, specArgOrExpr) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitCalled 等待调用次数达到 n 次, ctx 结束时返回错误
+func (r *callRecorder) WaitCalled(ctx context.Context, n int) error {
+	return r.wait(ctx, func() bool {
+		return r.Times() >= n
+	}, func() string {
+		return fmt.Sprintf("wait called %d times", n)
+	})
+}
+
+// Calls 订阅调用记录, 先推送已有的调用, 之后每次调用完成时推送
+// 通道缓冲满时丢弃新的调用记录, 订阅者需要及时读取; mocker 取消(Cancel 或 Reset)之后通道关闭
+func (r *callRecorder) Calls() <-chan Call {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ch := make(chan Call, len(r.calls)+callsBuffer)
+	for _, c := range r.calls {
+		ch <- *c
+	}
+	if r.closed {
+		close(ch)
+		return ch
+	}
+	r.subscribers = append(r.subscribers, ch)
+	return ch
+}
+
+// closeCalls 关闭所有的订阅通道, 使 range mocker.Calls() 的订阅者退出
+func (r *callRecorder) closeCalls() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, ch := range r.subscribers {
+		close(ch)
+	}
+	r.subscribers = nil
+	r.closed = true
+}
+
+// EventuallyCalled 在 timeout 内调用次数达到 n 次, 超时时通过 t 报告错误并返回 false
+func (r *callRecorder) EventuallyCalled(t TestingT, timeout time.Duration, n int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := r.WaitCalled(ctx, n); err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return true
+}
+
+// EventuallyCalledWith 在 timeout 内有调用的参数符合条件, 超时时通过 t 报告错误并返回 false
+func (r *callRecorder) EventuallyCalledWith(t TestingT, timeout time.Duration, specArgOrExpr ...interface{}) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := r.wait(ctx, func() bool {
+		return r.CalledWith(specArgOrExpr...)
+	}, func() string {
+		return fmt.Sprintf("wait called with %v", specArgOrExpr)
+	})
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	return true
+}
+
+// wait 等待条件满足, 每次添加调用记录时重新检查条件
+func (r *callRecorder) wait(ctx context.Context, cond func() bool, desc func() string) error {
+	for {
+		r.lock.Lock()
+		changed := r.changed
+		r.lock.Unlock()
+		if cond() {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w, actual called %d times", desc(), ctx.Err(), r.Times())
+		}
+	}
+}
+
+// matchCall 判断调用参数是否符合条件
+func matchCall(c *Call, specArgOrExpr []interface{}) bool {
+	if len(specArgOrExpr) != len(c.args) {
+		return false
+	}
+	types := make([]reflect.Type, len(c.args))
+	for i, a := range c.args {
+		types[i] = a.Type()
+	}
+	exprs, err := arg.ToExpr(specArgOrExpr, types)
+	if err != nil {
+		panic("Call CalledWith(...) error: " + err.Error())
+	}
+	for i, expr := range exprs {
+		ok, err := expr.Eval([]reflect.Value{c.args[i]})
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// interceptCalls 添加对 apply 的拦截代理, 记录每次调用; 开启 debug 时打印调用日志
+// imp 代理函数, pFunc 不为 nil 时仅用于指定代理函数的类型
+// pFunc 动态代理函数, 不为 nil 时优先拦截 pFunc, 减少一层反射调用
+// isMethod 第一个参数是否为接收体(方法的接收体或接口的*IContext)
+func interceptCalls(imp interface{}, pFunc iface.PFunc, mocker Mocker, recorder *callRecorder,
+	isMethod bool) (interface{}, iface.PFunc) {
+	if imp == nil && pFunc == nil {
+		return imp, pFunc
+	}
+
+	call := pFunc
+	if call == nil {
+		impV := reflect.ValueOf(imp)
+		call = func(params []reflect.Value) []reflect.Value {
+			return callValue(impV, params)
+		}
+	}
+	intercepted := func(params []reflect.Value) []reflect.Value {
+		return recordCall(mocker, recorder, isMethod, hack.InterceptCallerSkip, params, call)
+	}
+
+	if imp != nil {
+		imp = reflect.MakeFunc(reflect.TypeOf(imp), intercepted).Interface()
+	}
+	if pFunc != nil {
+		pFunc = intercepted
+	}
+	return imp, pFunc
+}
+
+// recordCall 执行调用并记录
+// callerSkip 调用方相对 recordCall 的调用栈层次, 用于 debug 日志定位调用位置
+// 记录调用用到的 time.Since、sync.Mutex、strconv 等函数被 mock 时, 记录过程中再次进入 mock 不再记录, 直接执行原函数
+func recordCall(mocker Mocker, recorder *callRecorder, isMethod bool, callerSkip int, params []reflect.Value,
+	call func([]reflect.Value) []reflect.Value) []reflect.Value {
+	if inRecording() {
+		return callOrigin(mocker, params, call)
+	}
+	recorder.active.enter()
+	defer recorder.active.exit()
+
+	g := enterRecording()
+	c := &Call{
+		Seq:    recorder.nextSeq(),
+		Mocker: mocker.String(),
+		args:   params,
+	}
+	// 获取协程 id 和调用位置需要遍历调用栈, 只在需要时记录
+	if recorder.detailed() {
+		c.Goroutine = hack.GoroutineID()
+		// 相对 recordCall 少了 debugCall 和日志打印的调用栈
+		c.Caller = logger.Caller(callerSkip - 1)()
+	}
+	if isMethod && len(params) > 0 {
+		c.Receiver = params[0].Interface()
+		c.args = params[1:]
+	}
+	c.Args = values(c.args)
+	c.Time = time.Now()
+	exitRecording(g)
+
+	defer func() {
+		if p := recover(); p != nil {
+			g := enterRecording()
+			c.Duration = time.Since(c.Time)
+			c.Panic = p
+			recorder.add(c)
+			exitRecording(g)
+			panic(p)
+		}
+	}()
+
+	results := call(params)
+	g = enterRecording()
+	defer exitRecording(g)
+	c.Duration = time.Since(c.Time)
+	c.Results = values(results)
+	c.results = results
+	recorder.add(c)
+	debugCall(mocker, callerSkip, params, results)
+	return results
+}
+
+// recording 正在记录调用的协程数量, 为 0 时不需要检查当前协程是否重入
+var recording int32
+
+// recordingGs 正在记录调用的协程, key 为协程的 g 指针, 通过 recordingLock 保护
+var recordingGs = make(map[uintptr]int)
+
+// recordingLock recordingGs 的自旋锁, 不使用 sync.Mutex, 避免 mock 了 sync.Mutex 时递归
+var recordingLock int32
+
+// lockRecording 获取 recordingGs 的自旋锁
+func lockRecording() {
+	for !atomic.CompareAndSwapInt32(&recordingLock, 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+// unlockRecording 释放 recordingGs 的自旋锁
+func unlockRecording() {
+	atomic.StoreInt32(&recordingLock, 0)
+}
+
+// enterRecording 标记当前协程开始记录调用, 返回当前协程的 g 指针
+func enterRecording() uintptr {
+	g := hack.G()
+	lockRecording()
+	recordingGs[g]++
+	unlockRecording()
+	atomic.AddInt32(&recording, 1)
+	return g
+}
+
+// exitRecording 标记当前协程结束记录调用
+func exitRecording(g uintptr) {
+	atomic.AddInt32(&recording, -1)
+	lockRecording()
+	if recordingGs[g]--; recordingGs[g] <= 0 {
+		delete(recordingGs, g)
+	}
+	unlockRecording()
+}
+
+// inRecording 当前协程是否正在记录调用
+func inRecording() bool {
+	if atomic.LoadInt32(&recording) == 0 {
+		return false
+	}
+	g := hack.G()
+	lockRecording()
+	defer unlockRecording()
+	return recordingGs[g] > 0
+}
+
+// originHolder 可以获取原函数的 mocker
+type originHolder interface {
+	originFunc() interface{}
+}
+
+// originFunc 调用原函数的函数, 没有指定原函数并且不是共享 patch 时为 nil
+func (m *baseMocker) originFunc() interface{} {
+	return m.origin
+}
+
+// callOrigin 记录调用时重入 mock, 有原函数时执行原函数, 否则直接执行 mock 的实现, 都不再记录调用
+func callOrigin(mocker Mocker, params []reflect.Value, call func([]reflect.Value) []reflect.Value) []reflect.Value {
+	if h, ok := mocker.(originHolder); ok && h.originFunc() != nil {
+		origin := reflect.Indirect(reflect.ValueOf(h.originFunc()))
+		if origin.Kind() == reflect.Func && !origin.IsNil() {
+			return callValue(origin, params)
+		}
+	}
+	return call(params)
+}
+
+// callValue 调用函数, 兼容可变参数的函数
+func callValue(f reflect.Value, params []reflect.Value) []reflect.Value {
+	if f.Type().IsVariadic() {
+		return f.CallSlice(params)
+	}
+	return f.Call(params)
+}
+
+// values 将[]reflect.Value 转换为[]interface{}
+func values(vs []reflect.Value) []interface{} {
+	result := make([]interface{}, len(vs))
+	for i, v := range vs {
+		if v.IsValid() && v.CanInterface() {
+			result[i] = v.Interface()
+		}
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了按照调用方限定 mock 的生效范围, 支持了 mocker.When(XXX).CalledFrom("pkg.*"),
+// 来自其他调用方的调用通过跳板函数直接调用原函数。
+package mocker
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// originCaller 支持调用原函数的 mocker
+type originCaller interface {
+	// ensureOrigin 确保存在可调用的原函数, 没有时自动生成跳板函数
+	ensureOrigin()
+	// callOrigin 调用原函数
+	callOrigin(args []reflect.Value) []reflect.Value
+}
+
+// globPattern 将支持 * 通配符的 pattern 转换为正则表达式
+func globPattern(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+// matchFrames 调用栈中是否有任意一帧的函数名匹配其中一个 pattern
+func matchFrames(patterns []*regexp.Regexp, frames []string) bool {
+	for _, f := range frames {
+		for _, p := range patterns {
+			if p.MatchString(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callerFrames 获取当前调用栈的函数名, 跳过当前模块、反射和 runtime 的调用栈
+func callerFrames() []string {
+	const maxDepth = 64
+	pcs := make([]uintptr, maxDepth)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	result := make([]string, 0, n)
+	for {
+		f, more := frames.Next()
+		if !isInternalFrame(f.Function) && !strings.HasPrefix(f.Function, "runtime.") {
+			result = append(result, f.Function)
+		}
+		if !more {
+			return result
+		}
+	}
+}
+
+// autoOrigin 自动生成调用原函数的跳板函数, 需要取消当前的 mock 之后重新应用, 以便跳板函数拷贝原函数的指令
+// apply 重新应用 mock
+func (m *baseMocker) autoOrigin(funcTyp reflect.Type, apply func()) {
+	if m.origin != nil {
+		return
+	}
+	origin, err := m.autoTrampoline(funcTyp)
+	if err != nil {
+		panic(fmt.Sprintf("origin trampoline error: %v", err))
+	}
+	if m.guard != nil {
+		m.guard.Cancel()
+		m.guard = nil
+	}
+	m.origin = origin
+	apply()
+}
+
+// callOriginFunc 调用原函数
+func (m *baseMocker) callOriginFunc(args []reflect.Value) []reflect.Value {
+	origin := reflect.ValueOf(m.origin)
+	if origin.Kind() == reflect.Ptr {
+		origin = origin.Elem()
+	}
+	return callValue(origin, args)
+}
+
+// ensureOrigin 确保存在可调用的原函数
+func (m *DefMocker) ensureOrigin() {
+	m.autoOrigin(reflect.TypeOf(m.funcDef), func() {
+		m.doApply(m.imp, m.callback)
+	})
+}
+
+// callOrigin 调用原函数
+func (m *DefMocker) callOrigin(args []reflect.Value) []reflect.Value {
+	return m.callOriginFunc(args)
+}
+
+// ensureOrigin 确保存在可调用的原方法
+func (m *MethodMocker) ensureOrigin() {
+	m.autoOrigin(reflect.TypeOf(m.methodIns), func() {
+		m.doApply(m.imp, m.callback)
+	})
+}
+
+// callOrigin 调用原方法
+func (m *MethodMocker) callOrigin(args []reflect.Value) []reflect.Value {
+	return m.callOriginFunc(args)
+}
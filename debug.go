@@ -4,8 +4,6 @@ import (
 	"reflect"
 
 	"github.com/tencent/goom/arg"
-	"github.com/tencent/goom/internal/hack"
-	"github.com/tencent/goom/internal/iface"
 	"github.com/tencent/goom/internal/logger"
 )
 
@@ -14,42 +12,14 @@ const (
 	excludeFunc = "time.Now"
 )
 
-// interceptDebugInfo 添加对 apply 的拦截代理，截取函数调用信息用于 debug
-func interceptDebugInfo(imp interface{}, pFunc iface.PFunc, mocker Mocker) (interface{}, iface.PFunc) {
-	if !logger.IsDebugOpen() {
-		return imp, pFunc
+// debugCall 开启 debug 时打印 mock 调用日志
+// callerSkip 调用方相对 recordCall 的调用栈层次
+func debugCall(mocker Mocker, callerSkip int, params []reflect.Value, results []reflect.Value) {
+	// 日志打印用到了 time.Now,避免递归死循环
+	if !logger.IsDebugOpen() || mocker.String() == excludeFunc {
+		return
 	}
-
-	// 因为当使用了 when 时候,imp 代理会被覆盖,pFunc 会生效; 所以优先拦截有 pFunc 代理的 mock 回调
-	if pFunc != nil {
-		originPFunc := pFunc
-		pFunc = func(params []reflect.Value) []reflect.Value {
-			results := originPFunc(params)
-			// 日志打印用到了 time.Now,避免递归死循环
-			if mocker.String() == excludeFunc {
-				return results
-			}
-			logger.Consolefc(logger.DebugLevel, "mocker [%s] called, args [%s], results [%s]",
-				logger.Caller(hack.InterceptCallerSkip), mocker.String(), arg.SprintV(params), arg.SprintV(results))
-			return results
-		}
-		return imp, pFunc
-	}
-
-	if imp != nil {
-		originImp := imp
-		imp = reflect.MakeFunc(reflect.TypeOf(imp), func(params []reflect.Value) []reflect.Value {
-			results := reflect.ValueOf(originImp).Call(params)
-			// 日志打印用到了 time.Now,避免递归死循环
-			if mocker.String() == excludeFunc {
-				return results
-			}
-			logger.Consolefc(logger.DebugLevel, "mocker [%s] called, args [%s], results [%s]",
-				logger.Caller(hack.InterceptCallerSkip), mocker.String(), arg.SprintV(params), arg.SprintV(results))
-			return results
-		}).Interface()
-		return imp, pFunc
-	}
-
-	return imp, pFunc
+	// 相对调用方多出的 recordCall、debugCall 两层调用栈
+	logger.Consolefc(logger.DebugLevel, "mocker [%s] called, args [%s], results [%s]",
+		logger.Caller(callerSkip+2), mocker.String(), arg.SprintV(params), arg.SprintV(results))
 }
@@ -0,0 +1,42 @@
+package erro
+
+import "strconv"
+
+// LoadFailed 加载 mock 定义文件异常
+type LoadFailed struct {
+	file   string
+	line   int
+	target string
+	cause  error
+}
+
+// Error 返回错误字符串
+func (e *LoadFailed) Error() string {
+	s := e.file
+	if e.line > 0 {
+		s = s + ":" + strconv.Itoa(e.line)
+	}
+	if e.target != "" {
+		s = s + ": target [" + e.target + "]"
+	}
+	return s + ": " + e.cause.Error()
+}
+
+// Unwrap 获取错误的原因
+func (e *LoadFailed) Unwrap() error {
+	return e.cause
+}
+
+// Line 出错的行号, 未知时为 0
+func (e *LoadFailed) Line() int {
+	return e.line
+}
+
+// NewLoadFailedError 创建加载 mock 定义文件异常
+// file 文件路径
+// line 出错的行号, 未知时为 0
+// target mock 的目标符号
+// cause 错误原因
+func NewLoadFailedError(file string, line int, target string, cause error) error {
+	return &LoadFailed{file: file, line: line, target: target, cause: cause}
+}
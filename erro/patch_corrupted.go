@@ -0,0 +1,24 @@
+package erro
+
+import "strings"
+
+// PatchCorrupted patch 过的函数指令被外部修改异常
+type PatchCorrupted struct {
+	funcs []string
+}
+
+// Error 返回错误字符串
+func (p *PatchCorrupted) Error() string {
+	return "patched code modified externally: " + strings.Join(p.funcs, "; ")
+}
+
+// Funcs 被外部修改的函数描述
+func (p *PatchCorrupted) Funcs() []string {
+	return p.funcs
+}
+
+// NewPatchCorruptedError 创建指令被外部修改异常
+// funcs 被外部修改的函数描述
+func NewPatchCorruptedError(funcs []string) error {
+	return &PatchCorrupted{funcs: funcs}
+}
@@ -0,0 +1,77 @@
+package erro
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// ValueNotMatch 参数或返回值的类型不匹配异常
+type ValueNotMatch struct {
+	mocker   string
+	kind     string
+	index    int
+	required reflect.Type
+	actual   reflect.Type
+	reason   string
+}
+
+// Error 返回错误字符串
+func (v *ValueNotMatch) Error() string {
+	s := "type not match"
+	if v.mocker != "" {
+		s = "mocker [" + v.mocker + "] " + s
+	}
+	if v.index >= 0 {
+		kind := v.kind
+		if kind == "" {
+			kind = "value"
+		}
+		s = s + " at " + kind + "[" + strconv.Itoa(v.index) + "]"
+	}
+	s = s + ", required: " + typeString(v.required) + ", actual: " + typeString(v.actual)
+	if v.reason != "" {
+		s = s + ", " + v.reason
+	}
+	return s
+}
+
+// Required 期望的类型
+func (v *ValueNotMatch) Required() reflect.Type {
+	return v.required
+}
+
+// Actual 实际的类型
+func (v *ValueNotMatch) Actual() reflect.Type {
+	return v.actual
+}
+
+// At 指定参数或返回值的下标
+func (v *ValueNotMatch) At(index int) *ValueNotMatch {
+	c := *v
+	c.index = index
+	return &c
+}
+
+// Of 指定所属的 mocker 和类型(arg 或 return)
+func (v *ValueNotMatch) Of(mocker string, kind string) *ValueNotMatch {
+	c := *v
+	c.mocker = mocker
+	c.kind = kind
+	return &c
+}
+
+// typeString 类型名称, nil 时返回 nil
+func typeString(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	return t.String()
+}
+
+// NewValueNotMatchError 创建类型不匹配异常
+// required 期望的类型
+// actual 实际的类型
+// reason 不匹配的原因
+func NewValueNotMatchError(required reflect.Type, actual reflect.Type, reason string) *ValueNotMatch {
+	return &ValueNotMatch{index: -1, required: required, actual: actual, reason: reason}
+}
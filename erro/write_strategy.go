@@ -0,0 +1,29 @@
+package erro
+
+// WriteStrategyUnavailable .text 区内存写入方式不可用异常
+type WriteStrategyUnavailable struct {
+	strategy string
+	cause    error
+}
+
+// Error 返回错误字符串
+func (w *WriteStrategyUnavailable) Error() string {
+	return "memory write strategy [" + w.strategy + "] unavailable: " + w.cause.Error()
+}
+
+// Strategy 不可用的写入方式
+func (w *WriteStrategyUnavailable) Strategy() string {
+	return w.strategy
+}
+
+// Unwrap 获取导致写入方式不可用的错误
+func (w *WriteStrategyUnavailable) Unwrap() error {
+	return w.cause
+}
+
+// NewWriteStrategyUnavailableError 创建写入方式不可用异常
+// strategy 写入方式
+// cause 探测或者写入时的错误
+func NewWriteStrategyUnavailableError(strategy string, cause error) error {
+	return &WriteStrategyUnavailable{strategy: strategy, cause: cause}
+}
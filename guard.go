@@ -16,16 +16,21 @@ type MockGuard interface {
 	Apply()
 	// Cancel 取消 Mock
 	Cancel()
+	// Suspend 暂停 Mock, 可以通过 Resume 恢复
+	Suspend()
+	// Resume 恢复暂停的 Mock
+	Resume()
 }
 
 // iFaceMockGuard 接口 Mock 守卫
 type iFaceMockGuard struct {
-	ctx *iface.IContext
+	ctx    *iface.IContext
+	mocker *baseMocker
 }
 
 // newIFaceMockGuard 创建 iFaceMockGuard
-func newIFaceMockGuard(ctx *iface.IContext) *iFaceMockGuard {
-	return &iFaceMockGuard{ctx: ctx}
+func newIFaceMockGuard(ctx *iface.IContext, mocker *baseMocker) *iFaceMockGuard {
+	return &iFaceMockGuard{ctx: ctx, mocker: mocker}
 }
 
 // Apply 应用 mock
@@ -34,10 +39,21 @@ func (i *iFaceMockGuard) Apply() {
 }
 
 // Cancel 取消 mock
+// 取消之前拷贝出去的代理接口值仍然可能被调用, 因此不回收桩函数空间
 func (i *iFaceMockGuard) Cancel() {
 	i.ctx.Cancel()
 }
 
+// Suspend 暂停 mock
+func (i *iFaceMockGuard) Suspend() {
+	i.ctx.Suspend()
+}
+
+// Resume 恢复 mock
+func (i *iFaceMockGuard) Resume() {
+	i.ctx.Resume()
+}
+
 // patchMockGuard Patch 类型的 Mock 守卫
 type patchMockGuard struct {
 	patchGuard *patch.Guard
@@ -53,7 +69,17 @@ func (p *patchMockGuard) Apply() {
 	p.patchGuard.Apply()
 }
 
-// Cancel 取消 mock
+// Cancel 取消 mock, 并回收跳转到代理函数的桩函数
 func (p *patchMockGuard) Cancel() {
-	p.patchGuard.UnpatchWithLock()
+	p.patchGuard.Release()
+}
+
+// Suspend 暂停 mock, 恢复为下层的 patch 或者原函数的指令
+func (p *patchMockGuard) Suspend() {
+	p.patchGuard.Suspend()
+}
+
+// Resume 恢复 mock, 在栈顶时重新写入跳转指令
+func (p *patchMockGuard) Resume() {
+	p.patchGuard.Resume()
 }
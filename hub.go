@@ -0,0 +1,409 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了目标函数的共享 patch, 同一个函数只 patch 一次, 由分发函数依次执行拦截层,
+// 再按照调用方协程所在的作用域选择 mock 实现, 没有 mock 实现时通过跳板函数调用原函数。
+package mocker
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tencent/goom/internal/patch"
+	"github.com/tencent/goom/internal/proxy"
+)
+
+var (
+	// hubs 已经共享 patch 的目标函数
+	hubs = make(map[interface{}]*patchHub)
+	// plainPatches 直接 patch 的目标函数上的 mocker, 按照 patch 的先后顺序排列, 创建共享 patch 时迁移到分发函数中
+	plainPatches = make(map[interface{}][]*baseMocker)
+	// patchOwners 通过 mocker 创建的 patch 的来源, 用于泄漏检测
+	patchOwners = make(map[*patch.Guard]*patchOwner)
+	hubLock     sync.Mutex
+)
+
+// patchOwner patch 的来源
+type patchOwner struct {
+	// name mocker 的描述
+	name string
+	// site mocker 声明的代码位置
+	site string
+	// key 目标函数的唯一标识
+	key interface{}
+	// shared 是否为共享 patch
+	shared bool
+}
+
+// patchFunc 使用代理函数和跳板函数 patch 目标函数
+type patchFunc func(proxyFunc, trampolineFunc interface{}) (*patch.Guard, error)
+
+// patchTarget 被 patch 的目标函数
+type patchTarget struct {
+	// key 目标函数的唯一标识
+	key interface{}
+	// name 目标函数的名称
+	name string
+	// desc 目标函数类型的描述, 用于错误信息
+	desc string
+	// patch 执行 patch
+	patch patchFunc
+	// funcDef 原函数定义, 通过名称 patch 时为 nil
+	funcDef interface{}
+}
+
+// methodKey 方法的唯一标识
+type methodKey struct {
+	typ    reflect.Type
+	method string
+}
+
+// funcTarget 根据函数定义 patch
+func funcTarget(funcDef interface{}) patchTarget {
+	return patchTarget{
+		key:  reflect.ValueOf(funcDef).Pointer(),
+		name: functionName(funcDef),
+		desc: "proxy func definition",
+		patch: func(proxyFunc, trampolineFunc interface{}) (*patch.Guard, error) {
+			return proxy.Func(funcDef, proxyFunc, trampolineFunc)
+		},
+		funcDef: funcDef,
+	}
+}
+
+// nameTarget 根据函数名称 patch
+func nameTarget(funcName string) patchTarget {
+	return patchTarget{
+		key:  funcName,
+		name: funcName,
+		desc: "proxy func name",
+		patch: func(proxyFunc, trampolineFunc interface{}) (*patch.Guard, error) {
+			return proxy.FuncName(funcName, proxyFunc, trampolineFunc)
+		},
+	}
+}
+
+// methodTarget 根据结构体方法 patch
+func methodTarget(structDef interface{}, method string) patchTarget {
+	typ := reflect.TypeOf(structDef)
+	elem := typ
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return patchTarget{
+		key:  methodKey{typ: typ, method: method},
+		name: fmt.Sprintf("%s.(%s).%s", elem.PkgPath(), elem.Name(), method),
+		desc: "proxy method",
+		patch: func(proxyFunc, trampolineFunc interface{}) (*patch.Guard, error) {
+			return proxy.Method(typ, method, proxyFunc, trampolineFunc)
+		},
+		funcDef: reflect.ValueOf(structDef).MethodByName(method).Interface(),
+	}
+}
+
+// patchHub 共享 patch 的目标函数
+type patchHub struct {
+	key  interface{}
+	name string
+	// origin 调用原函数的跳板函数
+	origin interface{}
+	// originAddr 跳板函数的指令地址, 恢复原函数之后回收
+	originAddr uintptr
+	// originShared 跳板函数已经拷贝给 Origin 指定的原函数变量, 恢复原函数之后仍然可能被调用, 不再复用, 需要持有 hubLock
+	originShared bool
+	// dispatcher 分发函数, 跳转指令中只保存了函数地址, 需要内存持续持有
+	dispatcher interface{}
+	guard      *patch.Guard
+	// handlers 各作用域的 mock 实现栈, 栈顶的 mock 实现生效, key 为 nil 时表示全局生效的 mock 实现
+	handlers map[*mockScope][]*hubMockGuard
+	// layers 拦截层, 先注册的在外层
+	layers []*Layer
+	lock   sync.RWMutex
+	// active 进行中的调用
+	active inflight
+}
+
+// dispatch 依次执行拦截层, 再按照当前协程所在的作用域分发调用, 没有 mock 实现时调用原函数
+func (h *patchHub) dispatch(args []reflect.Value) []reflect.Value {
+	h.active.enter()
+	defer h.active.exit()
+	scope := currentScope()
+	h.lock.RLock()
+	g := h.handlerOf(scope)
+	if g == nil && scope != nil {
+		g = h.handlerOf(nil)
+	}
+	layers := make([]*Layer, 0, len(h.layers))
+	for _, l := range h.layers {
+		if !l.suspended && (l.scope == nil || l.scope == scope) {
+			layers = append(layers, l)
+		}
+	}
+	h.lock.RUnlock()
+
+	inner := reflect.ValueOf(h.origin).Elem()
+	if g != nil {
+		inner = g.handler
+	}
+	return runLayers(layers, inner, args)
+}
+
+// handlerOf 获取作用域内最后注册的未暂停的 mock 实现, 需要持有 h.lock
+func (h *patchHub) handlerOf(scope *mockScope) *hubMockGuard {
+	stack := h.handlers[scope]
+	for i := len(stack) - 1; i >= 0; i-- {
+		if !stack[i].suspended {
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// removeHandler 从作用域的 mock 实现栈中移除 g, 需要持有 h.lock
+func (h *patchHub) removeHandler(g *hubMockGuard) {
+	stack := h.handlers[g.scope]
+	for i, e := range stack {
+		if e == g {
+			stack = append(stack[:i:i], stack[i+1:]...)
+			break
+		}
+	}
+	if len(stack) == 0 {
+		delete(h.handlers, g.scope)
+		return
+	}
+	h.handlers[g.scope] = stack
+}
+
+// empty 是否没有任何 mock 实现和拦截层
+func (h *patchHub) empty() bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return len(h.handlers) == 0 && len(h.layers) == 0
+}
+
+// release 没有任何 mock 实现和拦截层时恢复原函数
+// 先恢复原函数的指令, 新的调用不再进入分发函数, 再等待进行中的调用结束之后回收桩函数和跳板函数
+// timeout 等待进行中的调用结束的超时时间, 为 0 时不等待
+func (h *patchHub) release(timeout time.Duration) {
+	hubLock.Lock()
+	if hubs[h.key] != h || !h.empty() {
+		hubLock.Unlock()
+		return
+	}
+	h.guard.UnpatchWithLock()
+	delete(hubs, h.key)
+	delete(patchOwners, h.guard)
+	shared := h.originShared
+	hubLock.Unlock()
+
+	waitInflight(&h.active, timeout, h.name)
+	h.guard.Release()
+	if shared {
+		proxy.RetireTrampoline(h.originAddr)
+	} else if h.active.count() == 0 {
+		proxy.ReleaseTrampoline(h.originAddr)
+	}
+}
+
+// hubOf 获取目标函数的共享 patch, 不存在时创建, 已经直接 patch 的 mocker 迁移为全局生效的 mock 实现
+// site 创建共享 patch 的 mocker 声明的代码位置, 需要持有 hubLock
+func hubOf(target patchTarget, funcTyp reflect.Type, site string) *patchHub {
+	if h, ok := hubs[target.key]; ok {
+		return h
+	}
+	origin, err := proxy.AutoTrampoline(funcTyp)
+	if err != nil {
+		panic(fmt.Sprintf("hub trampoline error: %v", err))
+	}
+
+	plains := plainPatches[target.key]
+	delete(plainPatches, target.key)
+	for i := len(plains) - 1; i >= 0; i-- {
+		pg := plains[i].guard.(*plainMockGuard).guard
+		delete(patchOwners, pg.patchGuard)
+		pg.Cancel()
+	}
+
+	h := &patchHub{
+		key:        target.key,
+		name:       target.name,
+		origin:     origin,
+		originAddr: reflect.ValueOf(origin).Elem().Pointer(),
+		handlers:   make(map[*mockScope][]*hubMockGuard),
+	}
+	h.dispatcher = reflect.MakeFunc(funcTyp, h.dispatch).Interface()
+	guard, err := target.patch(h.dispatcher, origin)
+	if err != nil {
+		panic(fmt.Sprintf("%s error: %v", target.desc, err))
+	}
+	guard.Apply()
+	h.guard = guard
+	hubs[target.key] = h
+	patchOwners[guard] = &patchOwner{name: target.name, site: site, key: target.key, shared: true}
+
+	for _, plain := range plains {
+		plain.guard = &hubMockGuard{hub: h, handler: reflect.ValueOf(plain.imp), mocker: plain,
+			suspended: plain.suspended}
+		plain.guard.Apply()
+	}
+	return h
+}
+
+// applyPatch 应用 mock, 目标函数已经共享 patch 或者 builder 限定了作用域时注册到分发函数, 否则直接 patch
+// 同一个 mocker 再次应用时先取消之前的 patch, 避免之前的 patch 残留在栈中
+// 之前使用的分发函数的跳板函数在取消之后可能被回收, 因此不再作为原函数
+func (m *baseMocker) applyPatch(target patchTarget, callback interface{}) {
+	if g, ok := m.guard.(*hubMockGuard); ok && m.origin == g.hub.origin {
+		m.origin = nil
+	}
+	if m.guard != nil {
+		m.guard.Cancel()
+		m.guard = nil
+	}
+	hubLock.Lock()
+	h, shared := hubs[target.key]
+	if !shared && !m.scoped() {
+		guard, err := target.patch(callback, m.origin)
+		if err != nil {
+			hubLock.Unlock()
+			panic(fmt.Sprintf("%s error: %v", target.desc, err))
+		}
+		plainPatches[target.key] = append(plainPatches[target.key], m)
+		patchOwners[guard] = &patchOwner{name: target.name, site: m.site, key: target.key}
+		hubLock.Unlock()
+
+		m.guard = &plainMockGuard{key: target.key, name: target.name, mocker: m, guard: newPatchMockGuard(guard)}
+	} else {
+		if !shared {
+			h = hubOf(target, reflect.TypeOf(callback), m.site)
+		}
+		hubLock.Unlock()
+
+		if m.shareOrigin(h.origin) {
+			hubLock.Lock()
+			h.originShared = true
+			hubLock.Unlock()
+		}
+		var scope *mockScope
+		if m.scoped() {
+			scope = m.builder.scope
+		}
+		m.guard = &hubMockGuard{hub: h, scope: scope, handler: reflect.ValueOf(callback), mocker: m}
+	}
+	m.guard.Apply()
+	m.imp = callback
+	m.patched = target
+	if target.funcDef != nil {
+		m.funcDef = target.funcDef
+	}
+}
+
+// shareOrigin 使用分发函数的跳板函数作为 mocker 的原函数, 指定了函数指针类型的原函数时拷贝跳板函数
+// 返回跳板函数是否拷贝给了调用方的原函数变量
+func (m *baseMocker) shareOrigin(origin interface{}) bool {
+	if m.origin == nil {
+		m.origin = origin
+		return false
+	}
+	v := reflect.ValueOf(m.origin)
+	if v.Kind() == reflect.Ptr && v.Type() == reflect.TypeOf(origin) {
+		v.Elem().Set(reflect.ValueOf(origin).Elem())
+		return true
+	}
+	return false
+}
+
+// plainMockGuard 直接 patch 的 Mock 守卫
+type plainMockGuard struct {
+	key    interface{}
+	name   string
+	mocker *baseMocker
+	guard  *patchMockGuard
+}
+
+// Apply 应用 mock
+func (g *plainMockGuard) Apply() {
+	g.guard.Apply()
+}
+
+// Cancel 取消 mock, 先恢复原函数的指令, 新的调用不再进入 mock,
+// 开启了 WaitInflight 时等待进行中的调用结束之后再回收桩函数
+func (g *plainMockGuard) Cancel() {
+	hubLock.Lock()
+	removePlain(g.key, g.mocker)
+	delete(patchOwners, g.guard.patchGuard)
+	g.guard.patchGuard.UnpatchWithLock()
+	hubLock.Unlock()
+	g.mocker.drain(g.name)
+	g.guard.Cancel()
+}
+
+// removePlain 移除直接 patch 目标函数的 mocker, 需要持有 hubLock
+func removePlain(key interface{}, m *baseMocker) {
+	plains := plainPatches[key]
+	for i, e := range plains {
+		if e == m {
+			plains = append(plains[:i:i], plains[i+1:]...)
+			break
+		}
+	}
+	if len(plains) == 0 {
+		delete(plainPatches, key)
+		return
+	}
+	plainPatches[key] = plains
+}
+
+// Suspend 暂停 mock
+func (g *plainMockGuard) Suspend() {
+	g.guard.Suspend()
+}
+
+// Resume 恢复 mock
+func (g *plainMockGuard) Resume() {
+	g.guard.Resume()
+}
+
+// hubMockGuard 共享 patch 的 Mock 守卫
+type hubMockGuard struct {
+	hub     *patchHub
+	scope   *mockScope
+	handler reflect.Value
+	mocker  *baseMocker
+	// suspended 是否被暂停, 暂停时分发到其他 mock 实现或者原函数, 需要持有 hub.lock
+	suspended bool
+}
+
+// Apply 注册 mock 实现, 压入作用域的 mock 实现栈顶, 已经注册时移动到栈顶
+func (g *hubMockGuard) Apply() {
+	g.hub.lock.Lock()
+	defer g.hub.lock.Unlock()
+	g.hub.removeHandler(g)
+	g.hub.handlers[g.scope] = append(g.hub.handlers[g.scope], g)
+}
+
+// Cancel 取消 mock 实现, 没有任何 mock 实现和拦截层之后恢复原函数
+func (g *hubMockGuard) Cancel() {
+	g.hub.lock.Lock()
+	g.hub.removeHandler(g)
+	g.hub.lock.Unlock()
+	g.mocker.drain(g.hub.name)
+	g.hub.release(g.mocker.inflightTimeout())
+}
+
+// Suspend 暂停 mock 实现, 调用分发到其他 mock 实现或者原函数
+// 暂停时保留注册, 避免共享 patch 在此期间被释放
+func (g *hubMockGuard) Suspend() {
+	g.hub.lock.Lock()
+	defer g.hub.lock.Unlock()
+	g.suspended = true
+}
+
+// Resume 恢复 mock 实现
+func (g *hubMockGuard) Resume() {
+	g.hub.lock.Lock()
+	defer g.hub.lock.Unlock()
+	g.suspended = false
+}
@@ -147,6 +147,14 @@ func (m *DefaultInterfaceMocker) Return(value ...interface{}) *When {
 	return when
 }
 
+// ReturnZero 返回值全部使用零值
+func (m *DefaultInterfaceMocker) ReturnZero() *When {
+	if m.funcDef == nil {
+		panic("must use As() API before call ReturnZero()")
+	}
+	return m.Return(zeroResults(reflect.TypeOf(m.funcDef))...)
+}
+
 // Returns 指定返回多个值
 func (m *DefaultInterfaceMocker) Returns(values ...interface{}) *When {
 	if m.funcDef == nil {
@@ -185,7 +193,7 @@ func (m *DefaultInterfaceMocker) Inject(interface{}) InterfaceMocker {
 // applyByIFaceMethod 根据接口方法应用 mock
 func (m *DefaultInterfaceMocker) applyByIFaceMethod(ctx *iface.IContext, iFace interface{},
 	method string, callback interface{}, implV iface.PFunc) {
-	callback, implV = interceptDebugInfo(callback, implV, m)
+	callback, implV = interceptCalls(callback, implV, m, m.callRecorder, true)
 	m.baseMocker.applyByIFaceMethod(ctx, iFace, method, callback, implV)
 	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(6), m.String())
 }
@@ -3,6 +3,7 @@
 package mocker_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -175,6 +176,45 @@ func (s *ifaceMockerTestSuite) TestUnitArgsNotMatch() {
 	})
 }
 
+// TestUnitInterfaceFactoryReturn 测试工厂函数返回 mock 的接口
+func (s *ifaceMockerTestSuite) TestUnitInterfaceFactoryReturn() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").Apply(func(ctx *mocker.IContext, i int) int {
+			return 3
+		})
+		mock.Func(newI).Return(i, nil)
+
+		t, err := newI()
+		s.Nil(err, "factory mock check")
+		s.Equal(3, t.Call(1), "interface mock check")
+	})
+
+	s.Run("canceled", func() {
+		mock := mocker.Create()
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").Apply(func(ctx *mocker.IContext, i int) int {
+			return 3
+		})
+		mocked := i
+		mock.Reset()
+
+		s.Panics(func() {
+			mocker.Create().Func(newI).Return(mocked, nil)
+		}, "canceled interface mock check")
+	})
+}
+
+// newI 返回接口的工厂函数
+//
+//go:noinline
+func newI() (I, error) {
+	return nil, errors.New("not implemented")
+}
+
 // I 接口测试
 type I interface {
 	Call(int) int
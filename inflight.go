@@ -0,0 +1,76 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了进行中的调用计数, 支持了 mock.WaitInflight(timeout),
+// 取消 mock 时先还原原函数的指令, 再等待进行中的调用结束之后回收桩函数, 避免并发单测在 Reset 时崩溃。
+package mocker
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/tencent/goom/internal/logger"
+)
+
+// inflightPoll 等待进行中的调用结束时的轮询间隔
+const inflightPoll = time.Millisecond
+
+// inflight 进行中的调用计数
+type inflight struct {
+	n int64
+}
+
+// enter 开始调用
+func (f *inflight) enter() {
+	atomic.AddInt64(&f.n, 1)
+}
+
+// exit 结束调用
+func (f *inflight) exit() {
+	atomic.AddInt64(&f.n, -1)
+}
+
+// count 进行中的调用数量
+func (f *inflight) count() int64 {
+	return atomic.LoadInt64(&f.n)
+}
+
+// wait 等待进行中的调用结束, 超时返回 false
+// 按照轮询次数计算超时, 避免 time.Now 被 mock 时无法超时
+func (f *inflight) wait(timeout time.Duration) bool {
+	for i := time.Duration(0); f.count() > 0; i += inflightPoll {
+		if i >= timeout {
+			return false
+		}
+		<-time.After(inflightPoll)
+	}
+	return true
+}
+
+// WaitInflight 取消 mock 时还原原函数之后等待进行中的调用结束再回收桩函数, 最多等待 timeout
+// 超时之后打印告警并直接回收, 适用于后台协程仍然在调用被 mock 函数的并发单测
+func (b *Builder) WaitInflight(timeout time.Duration) *Builder {
+	b.inflightTimeout = timeout
+	return b
+}
+
+// inflightTimeout 取消 mock 时等待进行中的调用结束的超时时间, 为 0 时不等待
+func (m *baseMocker) inflightTimeout() time.Duration {
+	if m == nil || m.builder == nil {
+		return 0
+	}
+	return m.builder.inflightTimeout
+}
+
+// drain 等待 mocker 进行中的调用结束
+func (m *baseMocker) drain(name string) {
+	waitInflight(&m.active, m.inflightTimeout(), name)
+}
+
+// waitInflight 等待进行中的调用结束, 超时打印告警
+func waitInflight(f *inflight, timeout time.Duration, name string) {
+	if timeout <= 0 || f.wait(timeout) {
+		return
+	}
+	logger.Consolef(logger.WarningLevel, "[%s] still has %d in-flight calls after %s, release anyway",
+		name, f.count(), timeout)
+}
@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"sort"
+)
+
+// Write 一次 .text 区内存写入
+type Write struct {
+	// Addr 写入的地址
+	Addr uintptr
+	// Data 写入的数据
+	Data []byte
+}
+
+// pagesOf 批量写入涉及的内存页, 按照地址排序并去重
+func pagesOf(writes []Write, pageSize uintptr) []uintptr {
+	seen := make(map[uintptr]bool)
+	var pages []uintptr
+	for _, w := range writes {
+		for p := PageStart(w.Addr); p < w.Addr+uintptr(len(w.Data)); p += pageSize {
+			if !seen[p] {
+				seen[p] = true
+				pages = append(pages, p)
+			}
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i] < pages[j]
+	})
+	return pages
+}
+
+// writeEach 依次写入, 用于不支持按照内存页批量修改权限的平台
+func writeEach(writes []Write) error {
+	for _, w := range writes {
+		if err := WriteTo(w.Addr, w.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
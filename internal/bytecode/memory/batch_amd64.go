@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package memory
+
+import (
+	"syscall"
+)
+
+// rwx 批量写入时内存页的读、写和执行权限
+const rwx = syscall.PROT_READ | syscall.PROT_WRITE | syscall.PROT_EXEC
+
+// WriteBatch 批量写入 .text 区, 按照内存页分组, 每个内存页只修改一次读写权限
+// 所有内存页都获取到写权限之后才开始写入, 获取失败时不写入任何数据, 降级为依次写入
+// 降级写入时同样全程持有 memoryAccessLock, 其他写入不会穿插在批量写入之间
+func WriteBatch(writes []Write) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	memoryAccessLock.Lock()
+	defer memoryAccessLock.Unlock()
+	if fallbackWrite != nil {
+		// 替代的写入方式不需要修改内存页权限
+		return writeEachNoLock(writes)
+	}
+
+	pageSize := syscall.Getpagesize()
+	pages := pagesOf(writes, uintptr(pageSize))
+	for i, p := range pages {
+		if err := syscall.Mprotect(RawAccess(p, pageSize), rwx); err != nil {
+			_ = protectPages(pages[:i], pageSize)
+			// mac 环境下无法直接修改权限, 依次通过 hack 方式写入
+			return writeEachNoLock(writes)
+		}
+	}
+	for _, w := range writes {
+		copy(RawAccess(w.Addr, len(w.Data)), w.Data)
+	}
+	if err := protectPages(pages, pageSize); err != nil {
+		errorDetail(err)
+	}
+	return nil
+}
+
+// writeEachNoLock 依次写入, 不加锁, 调用方需要持有 memoryAccessLock
+func writeEachNoLock(writes []Write) error {
+	for _, w := range writes {
+		if err := writeToNoLock(w.Addr, w.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectPages 恢复内存页的读和执行权限
+func protectPages(pages []uintptr, pageSize int) error {
+	for _, p := range pages {
+		if err := syscall.Mprotect(RawAccess(p, pageSize), syscall.PROT_READ|syscall.PROT_EXEC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
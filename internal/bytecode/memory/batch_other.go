@@ -0,0 +1,9 @@
+//go:build windows || !amd64
+// +build windows !amd64
+
+package memory
+
+// WriteBatch 批量写入 .text 区, 当前平台依次写入
+func WriteBatch(writes []Write) error {
+	return writeEach(writes)
+}
@@ -19,7 +19,14 @@ const accessMemGuide = "https://github.com/tencent/goom"
 func WriteTo(addr uintptr, data []byte) error {
 	memoryAccessLock.Lock()
 	defer memoryAccessLock.Unlock()
+	return writeToNoLock(addr, data)
+}
 
+// writeToNoLock 写入 .text 区, 不加锁, 调用方需要持有 memoryAccessLock
+func writeToNoLock(addr uintptr, data []byte) error {
+	if fallbackWrite != nil {
+		return writeFallback(addr, data)
+	}
 	f := RawAccess(addr, len(data))
 	if err := mProtectCrossPage(addr, len(data), syscall.PROT_READ|syscall.PROT_WRITE|syscall.PROT_EXEC); err != nil {
 		// mac 环境下使用 hack 方式绕过权限检查
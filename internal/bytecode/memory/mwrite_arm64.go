@@ -8,7 +8,7 @@ package memory
 func WriteTo(addr uintptr, data []byte) error {
 	memoryAccessLock.Lock()
 	defer memoryAccessLock.Unlock()
-	if err := writeTo(addr, data); err != nil {
+	if err := WriteToNoFlushNoLock(addr, data); err != nil {
 		return err
 	}
 	ClearICache(addr)
@@ -19,10 +19,13 @@ func WriteTo(addr uintptr, data []byte) error {
 func WriteToNoFlush(addr uintptr, data []byte) error {
 	memoryAccessLock.Lock()
 	defer memoryAccessLock.Unlock()
-	return writeTo(addr, data)
+	return WriteToNoFlushNoLock(addr, data)
 }
 
 // WriteToNoFlushNoLock 写入 .text 区, 不刷新 icache, 不加锁
 func WriteToNoFlushNoLock(addr uintptr, data []byte) error {
+	if fallbackWrite != nil {
+		return writeFallback(addr, data)
+	}
 	return writeTo(addr, data)
 }
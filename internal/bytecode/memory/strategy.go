@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/tencent/goom/erro"
+)
+
+// Strategy .text 区内存的写入方式
+type Strategy string
+
+const (
+	// StrategyMprotect 通过 mprotect 临时修改内存页权限之后直接写入, 默认的写入方式
+	StrategyMprotect Strategy = "mprotect"
+	// StrategyProcMem 通过 /proc/self/mem 写入, 不需要修改内存页权限
+	StrategyProcMem Strategy = "/proc/self/mem"
+	// StrategyMemfd 将代码页重新映射为 memfd 的共享映射, 通过可写的映射写入
+	StrategyMemfd Strategy = "memfd"
+)
+
+var (
+	// strategy 当前使用的写入方式
+	strategy = StrategyMprotect
+	// fallbackWrite 替代 mprotect 的写入函数, 为 nil 时使用 mprotect 写入, 需要持有 memoryAccessLock
+	fallbackWrite func(addr uintptr, data []byte) error
+	// writers 当前平台支持的替代写入方式
+	writers = make(map[Strategy]func(addr uintptr, data []byte) error)
+	// probeErrors 探测写入方式时不可用的写入方式的错误, 类型为 *erro.WriteStrategyUnavailable
+	probeErrors []error
+)
+
+// CurrentStrategy 当前使用的写入方式
+func CurrentStrategy() Strategy {
+	memoryAccessLock.RLock()
+	defer memoryAccessLock.RUnlock()
+	return strategy
+}
+
+// ProbeErrors 初始化时探测到的不可用的写入方式, 类型为 *erro.WriteStrategyUnavailable
+func ProbeErrors() []error {
+	memoryAccessLock.RLock()
+	defer memoryAccessLock.RUnlock()
+	return append([]error(nil), probeErrors...)
+}
+
+// writeFallback 使用替代的写入方式写入, 失败时返回 *erro.WriteStrategyUnavailable, 需要持有 memoryAccessLock
+func writeFallback(addr uintptr, data []byte) error {
+	if err := fallbackWrite(addr, data); err != nil {
+		return erro.NewWriteStrategyUnavailableError(string(strategy), err)
+	}
+	return nil
+}
+
+// UseStrategy 指定写入方式, 当前平台不支持时返回 *erro.WriteStrategyUnavailable
+func UseStrategy(s Strategy) error {
+	memoryAccessLock.Lock()
+	defer memoryAccessLock.Unlock()
+	if s == StrategyMprotect {
+		strategy, fallbackWrite = s, nil
+		return nil
+	}
+	w, ok := writers[s]
+	if !ok {
+		return erro.NewWriteStrategyUnavailableError(string(s), fmt.Errorf("not supported on this platform"))
+	}
+	strategy, fallbackWrite = s, w
+	return nil
+}
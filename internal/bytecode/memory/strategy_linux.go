@@ -0,0 +1,172 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package memory
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"github.com/tencent/goom/erro"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// sysMemfdCreate memfd_create 的系统调用号, syscall 包在 amd64 下没有定义
+var sysMemfdCreate = map[string]uintptr{"amd64": 319, "arm64": 279}[runtime.GOARCH]
+
+// memfdAliases 已经重新映射的代码页, value 为代码页可写的映射, 需要持有 memoryAccessLock
+var memfdAliases = make(map[uintptr][]byte)
+
+func init() {
+	writers[StrategyProcMem] = procMemWrite
+	writers[StrategyMemfd] = memfdWrite
+	probe()
+}
+
+// probeTarget 探测写入方式时写入的函数, 写入的是原有的指令
+//
+//go:noinline
+func probeTarget() int {
+	return 1
+}
+
+// probe 按照 mprotect、/proc/self/mem、memfd 的顺序探测可用的写入方式
+// 在 SELinux execmod、PaX 等限制了修改代码段权限的环境下 mprotect 不可用
+func probe() {
+	addr := reflect.ValueOf(probeTarget).Pointer()
+	data := RawRead(addr, 1)
+	probes := []struct {
+		strategy Strategy
+		probe    func() error
+	}{
+		{StrategyMprotect, func() error { return probeMprotect(addr) }},
+		{StrategyProcMem, func() error { return procMemWrite(addr, data) }},
+		{StrategyMemfd, probeMemfd},
+	}
+	for _, p := range probes {
+		err := p.probe()
+		if err == nil {
+			strategy, fallbackWrite = p.strategy, writers[p.strategy]
+			if len(probeErrors) > 0 {
+				logger.Warningf("memory write strategy fallback to [%s], unavailable: %v", strategy, probeErrors)
+			}
+			return
+		}
+		probeErrors = append(probeErrors, erro.NewWriteStrategyUnavailableError(string(p.strategy), err))
+	}
+	// 都不可用时仍然使用 mprotect, 写入时报错并提示解决方案
+	logger.Errorf("no memory write strategy available: %v", probeErrors)
+}
+
+// probeMprotect 探测是否可以修改代码页的权限
+func probeMprotect(addr uintptr) error {
+	if err := mProtectCrossPage(addr, 1, syscall.PROT_READ|syscall.PROT_WRITE|syscall.PROT_EXEC); err != nil {
+		return err
+	}
+	return mProtectCrossPage(addr, 1, syscall.PROT_READ|syscall.PROT_EXEC)
+}
+
+// procMemWrite 通过 /proc/self/mem 写入, 内核按照 ptrace 的方式写入只读的代码页
+func procMemWrite(addr uintptr, data []byte) error {
+	f, err := os.OpenFile("/proc/self/mem", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, int64(addr)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// memfdWrite 将写入涉及的代码页重新映射为 memfd 的共享映射, 通过另一个可写的映射写入
+func memfdWrite(addr uintptr, data []byte) error {
+	pageSize := uintptr(syscall.Getpagesize())
+	for written := uintptr(0); written < uintptr(len(data)); {
+		cur := addr + written
+		page := PageStart(cur)
+		alias, err := memfdAlias(page, int(pageSize))
+		if err != nil {
+			return err
+		}
+		n := uintptr(copy(alias[cur-page:], data[written:]))
+		written += n
+	}
+	return nil
+}
+
+// memfdAlias 获取代码页可写的映射, 首次写入时将代码页拷贝到 memfd, 并以相同的内容原地重新映射为可执行
+func memfdAlias(page uintptr, pageSize int) ([]byte, error) {
+	if alias, ok := memfdAliases[page]; ok {
+		return alias, nil
+	}
+	fd, err := memfdCreate()
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if _, err := syscall.Pwrite(fd, RawAccess(page, pageSize), 0); err != nil {
+		return nil, err
+	}
+	alias, err := syscall.Mmap(fd, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mmapFixed(page, pageSize, fd); err != nil {
+		_ = syscall.Munmap(alias)
+		return nil, err
+	}
+	memfdAliases[page] = alias
+	return alias, nil
+}
+
+// probeMemfd 探测是否可以创建 memfd 的可写映射和可执行映射, 不修改代码页
+func probeMemfd() error {
+	pageSize := syscall.Getpagesize()
+	fd, err := memfdCreate()
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Ftruncate(fd, int64(pageSize)); err != nil {
+		return err
+	}
+	alias, err := syscall.Mmap(fd, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer syscall.Munmap(alias)
+	exec, err := syscall.Mmap(fd, 0, pageSize, syscall.PROT_READ|syscall.PROT_EXEC, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	return syscall.Munmap(exec)
+}
+
+// memfdCreate 创建匿名的内存文件
+func memfdCreate() (int, error) {
+	if sysMemfdCreate == 0 {
+		return -1, fmt.Errorf("memfd_create not supported on %s", runtime.GOARCH)
+	}
+	name := []byte("goom-text\x00")
+	fd, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(&name[0])), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// mmapFixed 将 memfd 以可执行的共享映射原地替换代码页
+func mmapFixed(page uintptr, pageSize int, fd int) (uintptr, error) {
+	addr, _, errno := syscall.Syscall6(syscall.SYS_MMAP, page, uintptr(pageSize),
+		syscall.PROT_READ|syscall.PROT_EXEC, syscall.MAP_SHARED|syscall.MAP_FIXED, uintptr(fd), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return addr, nil
+}
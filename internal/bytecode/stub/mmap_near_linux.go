@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package stub
+
+import (
+	"syscall"
+
+	"github.com/tencent/goom/internal/logger"
+)
+
+// nearHints 申请相近内存时相对目标地址的偏移量, 依次尝试直到申请到的内存在短跳转指令的范围内
+var nearHints = []int64{256 << 20, 512 << 20, 1 << 30, -(256 << 20), -(512 << 20), -(1 << 30)}
+
+// acquireFromMMapNear 在 origin 附近(短跳转指令可以到达的范围内)申请可执行内存
+// 以 origin 附近的地址作为 mmap 的提示地址, 内核没有采用提示地址时释放之后尝试下一个地址
+func acquireFromMMapNear(origin uintptr, len int) (uintptr, error) {
+	pageSize := uintptr(syscall.Getpagesize())
+	for _, delta := range nearHints {
+		if delta < 0 && origin < uintptr(-delta) {
+			continue
+		}
+		hint := uintptr(int64(origin)+delta) &^ (pageSize - 1)
+		addr, _, errno := syscall.Syscall6(syscall.SYS_MMAP, hint, uintptr(len),
+			syscall.PROT_READ|syscall.PROT_WRITE|syscall.PROT_EXEC,
+			syscall.MAP_PRIVATE|syscall.MAP_ANON, ^uintptr(0), 0)
+		if errno != 0 {
+			logger.Debugf("acquireFromMMapNear fail: %v\n", errno)
+			return 0, errno
+		}
+		if isNear(origin, addr) && isNear(origin, addr+uintptr(len)) {
+			return addr, nil
+		}
+		_, _, _ = syscall.Syscall(syscall.SYS_MUNMAP, addr, uintptr(len), 0)
+	}
+	return 0, errNotNear
+}
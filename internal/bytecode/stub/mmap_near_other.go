@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package stub
+
+// acquireFromMMapNear 在 origin 附近申请可执行内存, 当前系统暂不支持
+func acquireFromMMapNear(_ uintptr, _ int) (uintptr, error) {
+	return 0, errNotNear
+}
@@ -0,0 +1,274 @@
+package stub
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+
+	"github.com/tencent/goom/internal/logger"
+)
+
+const (
+	// slabSize 每次通过 mmap 申请的可执行内存大小, 多个桩函数共享同一块内存, 避免每个桩函数占用一个内存页
+	slabSize = 64 * 1024
+	// slabAlign 从 mmap 内存块中分配的空间按照 16 字节对齐
+	slabAlign = 16
+	// nearRange 短跳转指令(rel32)可以到达的范围, 预留 1MB 的余量
+	nearRange = 1<<31 - 1<<20
+)
+
+// errNotNear 无法申请到相近的可执行内存错误
+var errNotNear = errors.New("no executable space near the origin")
+
+// slab 通过 mmap 申请的可执行内存块, 按照偏移量依次分配
+type slab struct {
+	addr uintptr
+	size int
+	off  int
+}
+
+// freeKey 空闲链表的 key, 相同类型和大小的空间可以复用
+type freeKey struct {
+	typ  int
+	size int
+}
+
+// pool 可执行内存池
+// mmap 内存块和占位函数中分配的空间释放之后放入空闲链表, 再次申请相同大小的空间时优先复用
+// 短跳转指令跳转到的桩函数和通过 retire 释放的空间不再复用, 见 release
+type pool struct {
+	lock  sync.Mutex
+	slabs []*slab
+	// nearSlabs 在被 patch 的函数附近申请的内存块, 用于短跳转指令跳转到的桩函数
+	nearSlabs []*slab
+	free      map[freeKey][]*Space
+	inUse     map[uintptr]*Space
+	reused    int
+	// retired 已经释放但是不再复用的空间的数量和大小
+	retired      int
+	retiredBytes int
+}
+
+// spacePool 全局的可执行内存池
+var spacePool = &pool{
+	free:  make(map[freeKey][]*Space),
+	inUse: make(map[uintptr]*Space),
+}
+
+// Stats 可执行内存的使用情况
+type Stats struct {
+	// Slabs 通过 mmap 申请的内存块数量
+	Slabs int
+	// SlabBytes 通过 mmap 申请的内存总大小
+	SlabBytes int
+	// HolderBytes 占位函数的总大小
+	HolderBytes int
+	// HolderUsed 占位函数中已经分配的大小(包含空闲链表中的空间)
+	HolderUsed int
+	// InUse 使用中的空间数量
+	InUse int
+	// InUseBytes 使用中的空间大小
+	InUseBytes int
+	// Free 空闲链表中等待复用的空间数量
+	Free int
+	// FreeBytes 空闲链表中等待复用的空间大小
+	FreeBytes int
+	// Reused 累计复用空闲空间的次数
+	Reused int
+	// Retired 已经释放但是不再复用的空间数量
+	Retired int
+	// RetiredBytes 已经释放但是不再复用的空间大小
+	RetiredBytes int
+}
+
+// ReadStats 获取可执行内存的使用情况
+func ReadStats() Stats {
+	p := spacePool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := Stats{
+		Slabs:        len(p.slabs) + len(p.nearSlabs),
+		HolderBytes:  int(placeHolderIns.max - placeHolderIns.min),
+		HolderUsed:   int(placeHolderIns.off - placeHolderIns.min),
+		InUse:        len(p.inUse),
+		Reused:       p.reused,
+		Retired:      p.retired,
+		RetiredBytes: p.retiredBytes,
+	}
+	if s.HolderUsed > s.HolderBytes {
+		s.HolderUsed = s.HolderBytes
+	}
+	for _, sl := range p.slabs {
+		s.SlabBytes += sl.size
+	}
+	for _, sl := range p.nearSlabs {
+		s.SlabBytes += sl.size
+	}
+	for _, space := range p.inUse {
+		s.InUseBytes += space.size
+	}
+	for _, spaces := range p.free {
+		s.Free += len(spaces)
+		for _, space := range spaces {
+			s.FreeBytes += space.size
+		}
+	}
+	return s
+}
+
+// acquire 获取指定类型的空间, 优先从空闲链表中复用
+func (p *pool) acquire(typ int, size int) (*Space, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if s := p.reuse(typ, size); s != nil {
+		return s, nil
+	}
+	var (
+		addr uintptr
+		err  error
+	)
+	if typ == TypeMMap {
+		addr, err = p.allocSlab(size)
+	} else {
+		addr, _, err = acquireFromHolder(size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Space{Addr: addr, Space: sliceOf(addr, size), typ: typ, size: size}
+	p.inUse[addr] = s
+	return s, nil
+}
+
+// reuse 从空闲链表中取出相同类型和大小的空间
+func (p *pool) reuse(typ int, size int) *Space {
+	key := freeKey{typ: typ, size: size}
+	spaces := p.free[key]
+	if len(spaces) == 0 {
+		return nil
+	}
+	s := spaces[len(spaces)-1]
+	p.free[key] = spaces[:len(spaces)-1]
+	s.released = false
+	p.inUse[s.Addr] = s
+	p.reused++
+	return s
+}
+
+// allocSlab 从 mmap 内存块中分配空间, 当前内存块剩余空间不足时申请新的内存块
+func (p *pool) allocSlab(size int) (uintptr, error) {
+	if n := len(p.slabs); n > 0 {
+		if sl := p.slabs[n-1]; sl.off+size <= sl.size {
+			addr := sl.addr + uintptr(sl.off)
+			sl.off += size
+			return addr, nil
+		}
+	}
+	slabLen := slabSize
+	if size > slabLen {
+		slabLen = size
+	}
+	addr, _, err := acquireFromMMap(slabLen)
+	if err != nil {
+		return 0, err
+	}
+	p.slabs = append(p.slabs, &slab{addr: addr, size: slabLen, off: size})
+	logger.Debugf("stub slab acquired: 0x%x %d\n", addr, slabLen)
+	return addr, nil
+}
+
+// acquireNear 从 origin 附近的内存块中分配新的空间, 释放的短跳转桩函数不会被复用
+func (p *pool) acquireNear(origin uintptr, size int) (*Space, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	addr, err := p.allocNearSlab(origin, size)
+	if err != nil {
+		return nil, err
+	}
+	s := &Space{Addr: addr, Space: sliceOf(addr, size), typ: TypeNear, size: size}
+	p.inUse[addr] = s
+	return s, nil
+}
+
+// allocNearSlab 从 origin 附近的内存块中分配空间, 没有剩余空间足够的内存块时在 origin 附近申请新的内存块
+func (p *pool) allocNearSlab(origin uintptr, size int) (uintptr, error) {
+	for _, sl := range p.nearSlabs {
+		if sl.off+size <= sl.size && isNear(origin, sl.addr) && isNear(origin, sl.addr+uintptr(sl.size)) {
+			addr := sl.addr + uintptr(sl.off)
+			sl.off += size
+			return addr, nil
+		}
+	}
+	addr, err := acquireFromMMapNear(origin, slabSize)
+	if err != nil {
+		return 0, err
+	}
+	p.nearSlabs = append(p.nearSlabs, &slab{addr: addr, size: slabSize, off: size})
+	logger.Debugf("stub near slab acquired: 0x%x for 0x%x\n", addr, origin)
+	return addr, nil
+}
+
+// isNear addr 是否在 origin 的短跳转指令可以到达的范围内
+func isNear(origin, addr uintptr) bool {
+	if addr > origin {
+		return addr-origin < nearRange
+	}
+	return origin-addr < nearRange
+}
+
+// release 释放空间到空闲链表, 重复释放或者不是从内存池中分配的空间返回 false
+// 短跳转桩函数不放入空闲链表: 恢复原函数之后, 已经执行了短跳转指令的协程仍然可能还没有执行到桩函数中的指令,
+// 无法确定这些协程什么时候执行完成, 桩函数被复用之后会执行新的代理函数
+func (p *pool) release(addr uintptr) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s, ok := p.inUse[addr]
+	if !ok {
+		return false
+	}
+	if s.typ == TypeNear {
+		p.retireLocked(s)
+		return true
+	}
+	delete(p.inUse, addr)
+	s.released = true
+	key := freeKey{typ: s.typ, size: s.size}
+	p.free[key] = append(p.free[key], s)
+	return true
+}
+
+// retire 释放空间但是不放入空闲链表, 用于释放之后仍然可能被执行的空间, 重复释放或者不是从内存池中分配的空间返回 false
+func (p *pool) retire(addr uintptr) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s, ok := p.inUse[addr]
+	if !ok {
+		return false
+	}
+	p.retireLocked(s)
+	return true
+}
+
+// retireLocked 将使用中的空间标记为不再复用, 需要持有 p.lock
+func (p *pool) retireLocked(s *Space) {
+	delete(p.inUse, s.Addr)
+	s.released = true
+	p.retired++
+	p.retiredBytes += s.size
+}
+
+// alignSize 计算 mmap 内存块中分配的空间大小
+func alignSize(size int) int {
+	return (size + slabAlign - 1) / slabAlign * slabAlign
+}
+
+// sliceOf 将可执行空间转换为 []byte, addr 为 mmap 申请的内存, 不在 Go 的堆上
+func sliceOf(addr uintptr, size int) *[]byte {
+	s := unsafe.Slice((*byte)(unsafe.Add(nil, addr)), size)
+	return &s
+}
@@ -11,6 +11,8 @@ const (
 	TypeHolder = 1
 	// TypeMMap mmap 方式获取可执行内存
 	TypeMMap = 2
+	// TypeNear 在目标地址附近通过 mmap 方式获取可执行内存
+	TypeNear = 3
 )
 
 // Space 可执行空间
@@ -18,33 +20,58 @@ type Space struct {
 	Addr  uintptr
 	Space *[]byte
 	typ   int
+	// size 分配的空间大小
+	size int
+	// released 是否已经释放到空闲链表
+	released bool
 }
 
 // Acquire enough executable space
-// nolint
+// 优先从 mmap 内存块中分配, 失败时从占位函数中分配; 通过 Release 释放之后可以被复用
 func Acquire(spaceLen int) (*Space, error) {
-	if addr, space, err := acquireFromMMap(spaceLen); err == nil {
-		return &Space{
-			Addr:  addr,
-			Space: space,
-			typ:   TypeMMap,
-		}, nil
+	if s, err := spacePool.acquire(TypeMMap, alignSize(spaceLen)); err == nil {
+		return s, nil
 	}
-	if addr, space, err := acquireFromHolder(spaceLen); err == nil {
-		return &Space{
-			Addr:  addr,
-			Space: space,
-			typ:   TypeHolder,
-		}, nil
-	} else {
-		return nil, err
+	return spacePool.acquire(TypeHolder, spaceLen)
+}
+
+// AcquireNear 从占位函数中获取可执行空间
+// 占位函数位于代码段中, 与被 patch 的函数地址相近, 适用于包含相对地址跳转的跳板函数
+// 占位函数中的空间按照申请的大小原样分配, 调用方需要保证大小和指令对齐
+func AcquireNear(spaceLen int) (*Space, error) {
+	return spacePool.acquire(TypeHolder, spaceLen)
+}
+
+// AcquireNearTo 在 origin 附近(短跳转指令可以到达的 ±2GB 范围内)获取可执行空间
+// 适用于被 patch 的函数通过 5 字节的相对跳转指令跳转到的桩函数, 不从占位函数中分配, 避免挤占跳板函数的空间
+func AcquireNearTo(origin uintptr, spaceLen int) (*Space, error) {
+	return spacePool.acquireNear(origin, alignSize(spaceLen))
+}
+
+// Release 释放可执行空间到空闲链表, 之后申请相同大小的空间时复用
+// 调用方需要保证释放之后不会再执行空间中的指令; 短跳转桩函数释放之后不再复用
+func Release(s *Space) bool {
+	if s == nil || s.released {
+		return false
 	}
+	return spacePool.release(s.Addr)
+}
+
+// ReleaseAddr 根据起始地址释放可执行空间, 地址不是从内存池中分配时返回 false
+func ReleaseAddr(addr uintptr) bool {
+	return spacePool.release(addr)
+}
+
+// RetireAddr 根据起始地址释放可执行空间, 释放之后不再复用, 用于释放之后仍然可能被执行的空间
+// 地址不是从内存池中分配时返回 false
+func RetireAddr(addr uintptr) bool {
+	return spacePool.retire(addr)
 }
 
 // Write 写入数据
 func Write(s *Space, data []byte) error {
 	switch s.typ {
-	case TypeMMap:
+	case TypeMMap, TypeNear:
 		copy(*s.Space, data[:])
 		return nil
 	case TypeHolder:
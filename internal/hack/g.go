@@ -0,0 +1,7 @@
+//go:build amd64 || arm64
+
+package hack
+
+// G 获取当前协程的 g 结构体指针, 用于标识当前协程
+// 不调用任何可以被 mock 的函数, 协程退出之后 g 结构体可能被新的协程复用
+func G() uintptr
@@ -0,0 +1,8 @@
+//go:build !amd64 && !arm64
+
+package hack
+
+// G 获取当前协程的标识, 不支持读取 g 结构体指针的架构使用协程 id 代替
+func G() uintptr {
+	return uintptr(GoroutineID())
+}
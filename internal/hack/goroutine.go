@@ -0,0 +1,26 @@
+package hack
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// goroutinePrefix runtime.Stack 输出的首行前缀
+var goroutinePrefix = []byte("goroutine ")
+
+// GoroutineID 获取当前协程的 id
+// 通过解析 runtime.Stack 首行 "goroutine 1 [running]:" 获取, 解析失败时返回 0
+func GoroutineID() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, goroutinePrefix)
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
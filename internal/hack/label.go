@@ -0,0 +1,53 @@
+//go:build !goom_nolinkname
+
+package hack
+
+import (
+	"context"
+	"reflect"
+	"runtime/pprof"
+	"unsafe"
+)
+
+// ProfLabelSupported 是否支持读取协程的 pprof labels, 使用 -tags goom_nolinkname 构建时不支持
+const ProfLabelSupported = true
+
+// labelCtx 和 context.valueCtx 保持一致
+type labelCtx struct {
+	context.Context
+	key, val interface{}
+}
+
+// labelKey、labelType pprof 在 context 中保存 labels 使用的 key 和值的类型, 从 pprof.WithLabels 生成的 context 中获取
+var labelKey, labelType = probeLabelContext()
+
+// probeLabelContext 获取 pprof 在 context 中保存 labels 使用的 key 和值的类型, context 的实现不一致时返回 nil
+func probeLabelContext() (interface{}, unsafe.Pointer) {
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("goom", "probe"))
+	if reflect.TypeOf(ctx).String() != "*context.valueCtx" {
+		return nil, nil
+	}
+	c := (*labelCtx)((*Eface)(unsafe.Pointer(&ctx)).Data)
+	return c.key, (*Eface)(unsafe.Pointer(&c.val)).rtype
+}
+
+// ProfLabel 获取当前协程的 pprof labels 指针
+// 新建的协程会继承父协程的 labels 指针, 可以用来标识一棵协程树, 未设置 labels 时返回 nil
+func ProfLabel() unsafe.Pointer {
+	return runtimeGetProfLabel()
+}
+
+// LabelContext 将协程的 pprof labels 指针转换为 context, 以便通过 pprof.Label、pprof.ForLabels 读取 labels,
+// 或者通过 pprof.SetGoroutineLabels 恢复协程的 labels
+func LabelContext(parent context.Context, labels unsafe.Pointer) context.Context {
+	if labels == nil || labelType == nil {
+		return parent
+	}
+	var val interface{}
+	e := (*Eface)(unsafe.Pointer(&val))
+	e.rtype, e.Data = labelType, labels
+	return context.WithValue(parent, labelKey, val)
+}
+
+//go:linkname runtimeGetProfLabel runtime/pprof.runtime_getProfLabel
+func runtimeGetProfLabel() unsafe.Pointer
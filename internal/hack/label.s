@@ -0,0 +1,3 @@
+//go:build !goom_nolinkname
+
+// label.go 中的 go:linkname 声明没有函数体, 需要通过汇编文件避免编译器报错
@@ -0,0 +1,21 @@
+//go:build goom_nolinkname
+
+package hack
+
+import (
+	"context"
+	"unsafe"
+)
+
+// ProfLabelSupported 是否支持读取协程的 pprof labels, 使用 -tags goom_nolinkname 构建时不支持
+const ProfLabelSupported = false
+
+// ProfLabel 不通过 go:linkname 引用 runtime 的内部函数时无法获取协程的 pprof labels, 总是返回 nil
+func ProfLabel() unsafe.Pointer {
+	return nil
+}
+
+// LabelContext 无法读取协程的 pprof labels, 直接返回 parent
+func LabelContext(parent context.Context, _ unsafe.Pointer) context.Context {
+	return parent
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"unsafe"
 
+	"github.com/tencent/goom/internal/bytecode/stub"
 	"github.com/tencent/goom/internal/hack"
 	"github.com/tencent/goom/internal/unexports2"
 )
@@ -24,6 +25,25 @@ func (c *IContext) Cancel() {
 	c.p.canceled = true
 }
 
+// Suspend 暂停接口代理, 接口变量恢复为原始值
+func (c *IContext) Suspend() {
+	if c.p.canceled || c.p.suspended != nil || c.p.originIface == nil {
+		return
+	}
+	fake := *c.p.originIface
+	c.p.suspended = &fake
+	*c.p.originIface = *c.p.originIfaceValue
+}
+
+// Resume 恢复暂停的接口代理
+func (c *IContext) Resume() {
+	if c.p.canceled || c.p.suspended == nil {
+		return
+	}
+	*c.p.originIface = *c.p.suspended
+	c.p.suspended = nil
+}
+
 // Canceled 是否已经被取消
 func (c *IContext) Canceled() bool {
 	return c.p.canceled
@@ -40,6 +60,19 @@ func (c *IContext) Cache(key string, value *hack.Iface) {
 	c.p.ifaceCache[key] = value
 }
 
+// CacheKey 接口类型在上下文中缓存的 key
+func CacheKey(typ reflect.Type) string {
+	return typ.PkgPath() + "/" + typ.String()
+}
+
+// Fake 根据接口类型获取上下文中伪造的 iface 对象
+func (c *IContext) Fake(typ reflect.Type) (*hack.Iface, bool) {
+	if c.p.canceled {
+		return nil, false
+	}
+	return c.Cached(CacheKey(typ))
+}
+
 // NewContext 构造上下文
 func NewContext() *IContext {
 	return &IContext{
@@ -63,6 +96,8 @@ type PContext struct {
 	proxyFunc reflect.Value
 	// canceled 是否已经被取消
 	canceled bool
+	// suspended 暂停时保存的代理接口值
+	suspended *hack.Iface
 }
 
 // PFunc 代理函数类型的签名
@@ -106,7 +141,7 @@ func BackUpTo(ctx *IContext, iface unsafe.Pointer) {
 // GenCallableMethod 生成可以直接 CALL 的接口方法实现, 带上下文 (rdx)
 func GenCallableMethod(ctx *IContext, apply interface{}, proxy PFunc) uintptr {
 	var (
-		methodCaller uintptr
+		methodCaller *stub.Space
 		err          error
 	)
 
@@ -114,22 +149,22 @@ func GenCallableMethod(ctx *IContext, apply interface{}, proxy PFunc) uintptr {
 		// 生成桩代码,rdx 寄存器还原
 		applyValue := reflect.ValueOf(apply)
 		mockFuncPtr := (*hack.Value)(unsafe.Pointer(&applyValue)).Ptr
-		methodCaller, err = MakeMethodCaller(mockFuncPtr)
+		methodCaller, err = makeMethodCaller(mockFuncPtr)
 	} else {
 		// 生成桩代码,rdx 寄存器还原, 生成的调用将跳转到 proxy 函数
 		methodTyp := reflect.TypeOf(apply)
 		mockFunc := reflect.MakeFunc(methodTyp, proxy)
-		callStub, err := unexports2.FindFuncByName("reflect.makeFuncStub")
-		if err != nil {
-			panic(fmt.Sprintf("make interface err: %v", err))
+		callStub, findErr := unexports2.FindFuncByName("reflect.makeFuncStub")
+		if findErr != nil {
+			panic(fmt.Sprintf("make interface err: %v", findErr))
 		}
 		mockFuncPtr := (*hack.Value)(unsafe.Pointer(&mockFunc)).Ptr
-		methodCaller, err = MakeMethodCallerWithCtx(mockFuncPtr, callStub)
+		methodCaller, err = makeMethodCallerWithCtx(mockFuncPtr, callStub)
 		ctx.p.proxyFunc = mockFunc
 	}
 
 	if err != nil {
 		panic(err)
 	}
-	return methodCaller
+	return methodCaller.Addr
 }
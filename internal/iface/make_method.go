@@ -15,34 +15,54 @@ const interfaceJumpDataLen = 48
 // MakeMethodCaller 构造 interface 的方法调用并放到 stub 区
 // to 桩函数跳转到的地址
 func MakeMethodCaller(to unsafe.Pointer) (uintptr, error) {
-	space, err := stub.Acquire(interfaceJumpDataLen)
+	space, err := makeMethodCaller(to)
 	if err != nil {
 		return 0, err
 	}
+	return space.Addr, nil
+}
+
+// makeMethodCaller 构造 interface 的方法调用并放到 stub 区, 返回 stub 空间以便取消代理时回收
+func makeMethodCaller(to unsafe.Pointer) (*stub.Space, error) {
+	space, err := stub.Acquire(interfaceJumpDataLen)
+	if err != nil {
+		return nil, err
+	}
 
 	code := jmpWithRdx(uintptr(to))
 	if err := stub.Write(space, code); err != nil {
-		return 0, err
+		stub.Release(space)
+		return nil, err
 	}
 	bytecode.PrintInst("gen stub", space.Addr, bytecode.PrintMiddle, logger.DebugLevel)
-	return space.Addr, nil
+	return space, nil
 }
 
 // MakeMethodCallerWithCtx 构造 interface 的方法调用并放到 stub 区
 // ctx make Func 对象的上下文地址,即 @see reflect.makeFuncImpl
 // to 桩函数最终跳转到另一个地址
 func MakeMethodCallerWithCtx(ctx unsafe.Pointer, to uintptr) (uintptr, error) {
-	space, err := stub.Acquire(interfaceJumpDataLen)
+	space, err := makeMethodCallerWithCtx(ctx, to)
 	if err != nil {
 		return 0, err
 	}
+	return space.Addr, nil
+}
+
+// makeMethodCallerWithCtx 构造带上下文的 interface 方法调用并放到 stub 区, 返回 stub 空间以便取消代理时回收
+func makeMethodCallerWithCtx(ctx unsafe.Pointer, to uintptr) (*stub.Space, error) {
+	space, err := stub.Acquire(interfaceJumpDataLen)
+	if err != nil {
+		return nil, err
+	}
 
 	code := jmpWithRdx(uintptr(ctx))
 	if err := stub.Write(space, code); err != nil {
-		return 0, err
+		stub.Release(space)
+		return nil, err
 	}
 
 	bytecode.PrintInst("gen stub", space.Addr, bytecode.PrintLong, logger.DebugLevel)
 	bytecode.PrintInst("jump to", to, bytecode.PrintLong, logger.DebugLevel)
-	return space.Addr, nil
+	return space, nil
 }
@@ -0,0 +1,89 @@
+// Package patch 生成指令跳转(到代理函数)并替换.text 区内存
+package patch
+
+import (
+	"bytes"
+
+	"github.com/tencent/goom/internal/bytecode/memory"
+	"github.com/tencent/goom/internal/hack"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// batches 开启了批量写入的协程, key 为协程 id
+var batches = make(map[int64]*batch)
+
+// batch 批量写入, 记录被修改的函数地址, 提交时按照 patch 栈的状态统一写入
+type batch struct {
+	// dirty 被修改的函数地址和原始指令
+	dirty map[uintptr][]byte
+}
+
+// mark 记录被修改的函数地址
+func (b *batch) mark(origin uintptr, originBytes []byte) {
+	if _, ok := b.dirty[origin]; !ok {
+		b.dirty[origin] = originBytes
+	}
+}
+
+// currentBatch 当前协程的批量写入, 没有开启时返回 nil, 需要加锁调用
+func currentBatch() *batch {
+	if len(batches) == 0 {
+		return nil
+	}
+	return batches[hack.GoroutineID()]
+}
+
+// BeginBatch 当前协程开启批量写入, 之后 Apply、Unpatch 等操作的指令写入延迟到 CommitBatch 时统一写入
+// 当前协程已经开启批量写入时返回 false
+func BeginBatch() bool {
+	lock()
+	defer unlock()
+	id := hack.GoroutineID()
+	if _, ok := batches[id]; ok {
+		return false
+	}
+	batches[id] = &batch{dirty: make(map[uintptr][]byte)}
+	return true
+}
+
+// CommitBatch 按照 patch 栈当前的状态写入批量写入中被修改的函数, 同一个内存页只修改一次权限
+// 写入成功之后结束批量写入, 失败时保持开启, 可以取消 patch 之后通过 RollbackBatch 结束
+func CommitBatch() error {
+	lock()
+	defer unlock()
+	id := hack.GoroutineID()
+	b, ok := batches[id]
+	if !ok {
+		return nil
+	}
+	if err := b.flush(); err != nil {
+		return err
+	}
+	delete(batches, id)
+	return nil
+}
+
+// RollbackBatch 结束批量写入, 需要先取消批量写入中应用的 patch, 被修改的函数恢复为 patch 栈当前的状态
+func RollbackBatch() {
+	lock()
+	defer unlock()
+	id := hack.GoroutineID()
+	if b, ok := batches[id]; ok {
+		if err := b.flush(); err != nil {
+			logger.Errorf("rollback batch error: %s", err)
+		}
+		delete(batches, id)
+	}
+}
+
+// flush 写入被修改的函数当前生效的指令, 跳过内存中已经是目标指令的函数, 需要加锁调用
+func (b *batch) flush() error {
+	writes := make([]memory.Write, 0, len(b.dirty))
+	for origin, originBytes := range b.dirty {
+		data := activeBytes(origin, originBytes)
+		if !bytes.Equal(memory.RawRead(origin, len(data)), data) {
+			writes = append(writes, memory.Write{Addr: origin, Data: data})
+		}
+	}
+	return memory.WriteBatch(writes)
+}
@@ -40,3 +40,38 @@ func Test_fixIns(t *testing.T) {
 		t.Errorf("unpatch fail: %v", say)
 	}
 }
+
+// 测试同一个函数上叠加 patch 时, 跳板函数使用栈底登记的原始指令修复, 调用原函数而不是下层的 patch
+func Test_fixInsStacked(t *testing.T) {
+	lower, err := Patch(Say, func() string {
+		return "lower"
+	})
+	if err != nil {
+		t.Fatalf("patch error: %v", err)
+	}
+	lower.Apply()
+	defer lower.UnpatchWithLock()
+
+	originSay := func() string {
+		println("just redundancy")
+		return "anything"
+	}
+	upper, err := Trampoline(Say, func() string {
+		return "upper " + originSay()
+	}, &originSay)
+	if err != nil {
+		t.Fatalf("patch error: %v", err)
+	}
+	if say := Say(); say != "lower" {
+		t.Fatalf("stacking patch changed active patch: %v, expect: lower", say)
+	}
+	upper.Apply()
+
+	if say := Say(); say != "upper say" {
+		t.Fatalf("unexpected mock value returned: %v, expect: upper say", say)
+	}
+	upper.UnpatchWithLock()
+	if say := Say(); say != "lower" {
+		t.Errorf("restore lower fail: %v", say)
+	}
+}
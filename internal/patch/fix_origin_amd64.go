@@ -16,8 +16,10 @@ import (
 // from 原始函数位置
 // trampoline 自定义占位函数位置(注意, 自定义占位函数一定要和原函数相同的函数签名,否则栈帧不一致会导致计算调用堆栈时候抛异常)
 // jumpInstSize 跳转指令长度, 用于判断需要修复的最小指令长度
+// originBytes 原函数开头被已有 patch 的跳转指令覆盖的原始指令, 拷贝时替换内存中的跳转指令, 为 nil 时直接拷贝内存中的指令
 // return 跳板函数(即原函数调用入口指针)
-func fixOriginFuncToTrampoline(origin uintptr, trampoline uintptr, jumpInstSize int) (uintptr, error) {
+func fixOriginFuncToTrampoline(origin uintptr, trampoline uintptr, jumpInstSize int,
+	originBytes []byte) (uintptr, error) {
 	// get origin func size
 	originFuncSize, err := bytecode.GetFuncSize(defaultArchMod, origin, false)
 	if err != nil {
@@ -43,6 +45,7 @@ func fixOriginFuncToTrampoline(origin uintptr, trampoline uintptr, jumpInstSize
 
 	// copy origin function
 	fixOriginData := memory.RawRead(origin, originFuncSize)
+	copy(fixOriginData, originBytes)
 	bytecode.PrintInstf("origin inst >>>>> ", origin,
 		fixOriginData[:bytecode.MinSize(bytecode.PrintMiddle, fixOriginData)], logger.DebugLevel)
 
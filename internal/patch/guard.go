@@ -6,40 +6,54 @@ import (
 
 	"github.com/tencent/goom/internal/bytecode"
 	"github.com/tencent/goom/internal/bytecode/memory"
+	"github.com/tencent/goom/internal/bytecode/stub"
 	"github.com/tencent/goom/internal/logger"
 )
 
 // Guard 代理执行控制句柄, 可通过此对象进行代理还原
 type Guard struct {
-	origin       uintptr // 被 patch 的函数
-	originBytes  []byte  // 原始字节码
-	jumpBytes    []byte  // 跳转指令字节
-	fixOriginPtr uintptr // 修复的函数指针
-	applied      bool    // 是否已经被应用
+	origin       uintptr     // 被 patch 的函数
+	originBytes  []byte      // 原始字节码
+	jumpBytes    []byte      // 跳转指令字节
+	originSum    uint32      // 原始字节码的校验和
+	jumpSum      uint32      // 跳转指令字节的校验和
+	fixOriginPtr uintptr     // 修复的函数指针
+	jumpStub     *stub.Space // 短跳转指令跳转到的桩函数
+	applied      bool        // 是否已经被应用
+	suspended    bool        // 是否已经被暂停
+	released     bool        // 是否已经被回收
 }
 
 // Apply 执行
+// 同一个函数存在多个 patch 时, 只有栈顶已应用的 patch 生效
 func (g *Guard) Apply() {
 	lock()
 	defer unlock()
+	if g.released {
+		return
+	}
 
 	g.applied = true
-	// 执行函数调用地址替换(延迟执行)
-	if err := memory.WriteTo(g.origin, g.jumpBytes); err != nil {
-		logger.Errorf("Apply to 0x%x error: %s", g.origin, err)
+	push(g)
+	if activeGuard(g.origin) != g {
+		return
 	}
-	bytecode.PrintInst(fmt.Sprintf("apply copy to 0x%x", g.origin), g.origin, 30, logger.DebugLevel)
+	// 执行函数调用地址替换(延迟执行)
+	g.writeActive("apply")
 }
 
-// Unpatch 取消代理,还原指令码
+// Unpatch 取消代理, 将当前 patch 移出栈, 当前 patch 生效时恢复为下层的 patch, 没有下层的 patch 时还原指令码
 // 外部调用请使用 PatchGuard.UnpatchWithLock()
 func (g *Guard) Unpatch() {
-	if g != nil && g.applied {
-		if err := memory.WriteTo(g.origin, g.originBytes); err != nil {
-			logger.Errorf("Unpatch to 0x%x error: %s", g.origin, err)
-		}
-		bytecode.PrintInst(fmt.Sprintf("unpatch copy to 0x%x", g.origin), g.origin, 20, logger.DebugLevel)
+	if g == nil {
+		return
 	}
+	active := activeGuard(g.origin)
+	remove(g)
+	if !g.applied || active != g {
+		return
+	}
+	g.writeActive("unpatch")
 }
 
 // UnpatchWithLock 外部调用需要加锁
@@ -49,16 +63,79 @@ func (g *Guard) UnpatchWithLock() {
 	g.Unpatch()
 }
 
-// Restore 重新应用代理
+// Release 取消代理并释放短跳转指令跳转到的桩函数, 释放之后不能再重新应用
+// 桩函数释放之后不会被复用, 已经执行了短跳转指令的协程仍然可以执行原来的桩函数
+func (g *Guard) Release() {
+	lock()
+	defer unlock()
+	if g == nil || g.released {
+		return
+	}
+	g.Unpatch()
+	g.released = true
+	if g.jumpStub != nil {
+		stub.Release(g.jumpStub)
+		g.jumpStub = nil
+	}
+}
+
+// Restore 重新应用代理, 用于 Unpatch 之后恢复, 重新压入栈顶
 func (g *Guard) Restore() {
 	lock()
 	defer unlock()
-	if g != nil && g.applied {
-		if err := memory.WriteTo(g.origin, g.jumpBytes); err != nil {
-			logger.Errorf("Restore to 0x%x error: %s", g.origin, err)
+	if g != nil && g.applied && !g.released {
+		push(g)
+		if activeGuard(g.origin) != g {
+			return
 		}
-		bytecode.PrintInst(fmt.Sprintf("unpatch copy to 0x%x", g.origin), g.origin, 20, logger.DebugLevel)
+		g.writeActive("restore")
+	}
+}
+
+// Suspend 暂停代理, 保留在栈中的位置, 当前 patch 生效时恢复为下层的 patch 或者原始指令码
+func (g *Guard) Suspend() {
+	lock()
+	defer unlock()
+	if g == nil || g.suspended {
+		return
+	}
+	active := activeGuard(g.origin)
+	g.suspended = true
+	if active == g {
+		g.writeActive("suspend")
+	}
+}
+
+// Resume 恢复暂停的代理, 当前 patch 在栈顶时重新写入跳转指令
+func (g *Guard) Resume() {
+	lock()
+	defer unlock()
+	if g == nil || !g.suspended {
+		return
 	}
+	g.suspended = false
+	if activeGuard(g.origin) == g {
+		g.writeActive("resume")
+	}
+}
+
+// writeActive 写入函数当前生效的 patch 的跳转指令, 没有生效的 patch 时还原指令码, 需要加锁调用
+// 当前协程开启了批量写入时, 延迟到提交批量写入时再写入
+func (g *Guard) writeActive(action string) {
+	if b := currentBatch(); b != nil {
+		b.mark(g.origin, g.originBytes)
+		return
+	}
+	data := activeBytes(g.origin, g.originBytes)
+	if err := memory.WriteTo(g.origin, data); err != nil {
+		logger.Errorf("%s to 0x%x error: %s", action, g.origin, err)
+	}
+	bytecode.PrintInst(fmt.Sprintf("%s copy to 0x%x", action, g.origin), g.origin, 20, logger.DebugLevel)
+}
+
+// Origin 被 patch 的函数地址
+func (g *Guard) Origin() uintptr {
+	return g.origin
 }
 
 // FixOriginFunc 获取应用代理后的原函数地址(和代理前的原函数地址不一样)
@@ -0,0 +1,93 @@
+// Package patch 生成指令跳转(到代理函数)并替换.text 区内存
+package patch
+
+import (
+	"bytes"
+	"hash/crc32"
+
+	"github.com/tencent/goom/internal/bytecode/memory"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// Corruption 被外部修改的 patch 地址, 比如调试器插入了断点指令
+type Corruption struct {
+	// Origin 被 patch 的函数地址
+	Origin uintptr
+	// Expect 期望的指令
+	Expect []byte
+	// Actual 实际的指令
+	Actual []byte
+}
+
+// checksum 计算指令的校验和
+func checksum(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// activeBytes 函数地址上当前生效的 patch 的跳转指令, 没有生效的 patch 时为原始指令, 需要加锁调用
+func activeBytes(origin uintptr, originBytes []byte) []byte {
+	if g := activeGuard(origin); g != nil {
+		return g.jumpBytes
+	}
+	return originBytes
+}
+
+// expected 函数地址上期望的指令和校验和, 栈中的 patch 都暂停时为原始指令, 需要加锁调用
+func expected(origin uintptr) ([]byte, uint32) {
+	if g := activeGuard(origin); g != nil {
+		return g.jumpBytes, g.jumpSum
+	}
+	g := patches[origin][0]
+	return g.originBytes, g.originSum
+}
+
+// isPatched 指令是否为已登记的 patch 写入的跳转指令, 需要加锁调用
+// 通过 patch 登记表判断, 不依赖指令的特征字节, 原函数以 NOP 开头时不会误判
+func isPatched(origin uintptr, data []byte) bool {
+	for _, g := range patches[origin] {
+		if bytes.Equal(g.jumpBytes, data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify 按照登记的校验和检查所有 patch 过的函数地址, 返回被外部修改的地址, 按照函数地址排序
+func Verify() []*Corruption {
+	lock()
+	defer unlock()
+
+	var result []*Corruption
+	for _, origin := range sortedOrigins() {
+		expect, sum := expected(origin)
+		actual := memory.RawRead(origin, len(expect))
+		if checksum(actual) != sum {
+			result = append(result, &Corruption{Origin: origin, Expect: expect, Actual: actual})
+		}
+	}
+	return result
+}
+
+// RestoreAll 还原所有 patch 过的函数的原始指令并清空 patch 栈, 返回还原的函数数量
+// 用于进程退出之前的兜底, 还原之后已有的 Guard 不再生效
+func RestoreAll() int {
+	lock()
+	defer unlock()
+
+	for _, b := range batches {
+		b.dirty = make(map[uintptr][]byte)
+	}
+	count := 0
+	for origin, stack := range patches {
+		if err := memory.WriteTo(origin, stack[0].originBytes); err != nil {
+			logger.Errorf("RestoreAll to 0x%x error: %s", origin, err)
+			continue
+		}
+		for _, g := range stack {
+			g.applied = false
+		}
+		delete(patches, origin)
+		count++
+	}
+	return count
+}
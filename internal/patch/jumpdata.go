@@ -7,6 +7,7 @@ import (
 
 	"github.com/tencent/goom/internal/bytecode"
 	"github.com/tencent/goom/internal/bytecode/memory"
+	"github.com/tencent/goom/internal/bytecode/stub"
 	"github.com/tencent/goom/internal/logger"
 )
 
@@ -25,7 +26,10 @@ var errAlreadyPatch = errors.New("already patched")
 // replacementInAddr 要跳转到的函数调用地址
 // replacementCode 要跳转到的函数地址, 与 replacementInAddr 的区别详细可以参考:
 // https://docs.google.com/document/d/1bMwCey-gmqZVTpRax-ESeVuZGmjwbocYs1iHplK-cjo/pub
-func genJumpData(origin, replacementInAddr, replacementCode uintptr) (jumpData []byte, err error) {
+// width 同一个函数上已有 patch 的跳转指令长度, 没有时为 0
+// 优先织入跳转到相近桩函数的短跳转指令, 返回的 jumpStub 为短跳转指令跳转到的桩函数, 取消 patch 之后需要回收
+func genJumpData(origin, replacementInAddr, replacementCode uintptr, width int) (jumpData []byte,
+	jumpStub *stub.Space, err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			logger.Errorf("genJumpData origin=%d replacementInAddr=%d error:%s", origin, replacementInAddr, e)
@@ -49,23 +53,36 @@ func genJumpData(origin, replacementInAddr, replacementCode uintptr) (jumpData [
 		funcSize = defaultFuncSize
 	}
 
-	// 构造跳转到代理函数的指令
-	jumpData = jmpToFunctionValue(origin, replacementInAddr)
+	// 构造跳转到代理函数的指令, 优先使用跳转到相近桩函数的短跳转指令
+	// 同一个函数上的 patch 使用相同长度的跳转指令, 避免取消上层 patch 之后残留上层跳转指令的字节
+	jumpData, jumpStub = jmpToNearStub(origin, replacementInAddr)
+	if jumpData != nil && width > 0 && len(jumpData) != width {
+		stub.Release(jumpStub)
+		jumpData, jumpStub = nil, nil
+	}
+	if jumpData == nil {
+		jumpData = jmpToFunctionValue(origin, replacementInAddr)
+	}
+	if width > 0 && len(jumpData) != width {
+		return nil, nil, fmt.Errorf(
+			"jumpInstSize[%d] is not equal to patched jumpInstSize[%d], cannot do pathes", len(jumpData), width)
+	}
 	// 如果需要织入的跳转指令的长度大于原函数指令长度,则任务是无法织入指令
 	if len(jumpData) >= funcSize {
+		stub.Release(jumpStub)
 		bytecode.PrintInst("origin inst > ", origin, bytecode.PrintShort, logger.InfoLevel)
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"jumpInstSize[%d] is bigger than origin FuncSize[%d], cannot do pathes", len(jumpData), funcSize)
 	}
-	return jumpData, nil
+	return jumpData, jumpStub, nil
 }
 
-// checkAndReadOriginBytes 检查原函数是否已经 patch 过, 并且发挥原函数的字节码数组
-func checkAndReadOriginBytes(origin uintptr, jumpDataLen int) ([]byte, error) {
+// checkAndReadOriginBytes 检查原函数是否已经 patch 过, 并且返回原函数的字节码数组, 需要加锁调用
+func checkAndReadOriginBytes(origin uintptr, jumpData []byte) ([]byte, error) {
 	// 读取原始指令
-	result := memory.RawRead(origin, jumpDataLen)
-	// 判断是否已经被 patch 过
-	if checkAlreadyPatch(result) {
+	result := memory.RawRead(origin, len(jumpData))
+	// 根据 patch 登记表判断是否已经被 patch 过
+	if isPatched(origin, result) {
 		return nil, fmt.Errorf("origin: 0x%x is already patched, %w", origin, errAlreadyPatch)
 	}
 	bytecode.PrintInst("origin >>>>> ", origin, bytecode.PrintShort, logger.DebugLevel)
@@ -122,6 +122,8 @@ func InstanceMethodTrampoline(originType reflect.Type, methodName string, replac
 // Unpatch removes any monkey patches on target
 // returns whether target was patched in the first place
 func Unpatch(origin interface{}) bool {
+	lock()
+	defer unlock()
 	return unpatchValue(reflect.ValueOf(origin).Pointer())
 }
 
@@ -134,26 +136,32 @@ func UnpatchInstanceMethod(originType reflect.Type, methodName string) bool {
 		return false
 	}
 
+	lock()
+	defer unlock()
 	return unpatchValue(m.Func.Pointer())
 }
 
 // UnpatchAll removes all applied monkey patches
 func UnpatchAll() {
-	for target, p := range patches {
-		p.unpatch()
-		delete(patches, target)
+	lock()
+	defer unlock()
+	for target := range patches {
+		unpatchValue(target)
 	}
 }
 
-// unpatchValue removes a monkeypatch from the specified function
+// unpatchValue removes all monkeypatches stacked on the specified function
 // returns whether the function was patched in the first place
 func unpatchValue(origin uintptr) bool {
-	p, ok := patches[origin]
+	stack, ok := patches[origin]
 	if !ok {
 		return false
 	}
 
-	p.unpatch()
+	// 由上至下依次取消, 最终还原为原始指令码
+	for i := len(stack) - 1; i >= 0; i-- {
+		stack[i].Unpatch()
+	}
 	delete(patches, origin)
 	return true
 }
@@ -1,7 +1,11 @@
 package patch
 
-// nopOpcode 空指令插入到原函数开头第一个字节, 用于判断原函数是否已经被 Patch 过
-const nopOpcode = 0x90
+import "github.com/tencent/goom/internal/bytecode/stub"
+
+// jmpToNearStub 短跳转到相近的桩函数, 暂不支持
+func jmpToNearStub(_, _ uintptr) ([]byte, *stub.Space) {
+	return nil, nil
+}
 
 // jmpToFunctionValue Assembles a jump to a function value
 func jmpToFunctionValue(_, to uintptr) []byte {
@@ -14,11 +18,3 @@ func jmpToFunctionValue(_, to uintptr) []byte {
 		0xFF, 0x22,     // jmp DWORD PTR [edx]
 	}
 }
-
-// checkAlreadyPatch 检测是否已经 patch
-func checkAlreadyPatch(origin []byte) bool {
-	if origin[0] == nopOpcode {
-		return true
-	}
-	return false
-}
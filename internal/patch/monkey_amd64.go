@@ -1,9 +1,13 @@
 package patch
 
-import "unsafe"
+import (
+	"unsafe"
 
-// nopOpcode 空指令插入到原函数开头第一个字节, 用于判断原函数是否已经被 Patch 过
-const nopOpcode byte = 0x90
+	"github.com/tencent/goom/internal/bytecode/stub"
+)
+
+// nearStubLen 短跳转指令跳转到的桩函数的长度
+const nearStubLen = 12
 
 // jmpToFunctionValue Assembles a jump to a function value
 func jmpToFunctionValue(_, to uintptr) (value []byte) {
@@ -55,6 +59,26 @@ func jmpToOriginFunctionValue(from, to uintptr) (value []byte) {
 	}
 }
 
+// jmpToNearStub 构造跳转到 origin 附近的桩函数的 5 字节相对跳转指令, 桩函数加载函数值之后跳转
+// 相比直接织入 13 字节的跳转指令, 覆盖的原函数指令更少, 指令较短的函数也可以 patch
+// 无法在 origin 附近获取可执行空间时返回 nil
+func jmpToNearStub(origin, to uintptr) ([]byte, *stub.Space) {
+	space, err := stub.AcquireNearTo(origin, nearStubLen)
+	if err != nil {
+		return nil, nil
+	}
+	if !relative(origin, space.Addr) {
+		stub.Release(space)
+		return nil, nil
+	}
+	// 桩函数的指令与直接织入的跳转指令相同, 去掉开头的 NOP
+	if err := stub.Write(space, jmpToFunctionValue(origin, to)[1:]); err != nil {
+		stub.Release(space)
+		return nil, nil
+	}
+	return jmpToOriginFunctionValue(origin, space.Addr), space
+}
+
 // relative 判断两个指针间隔是否可以用相对地址表示
 func relative(from uintptr, to uintptr) bool {
 	delta := int64(from - to)
@@ -71,8 +95,3 @@ func relative(from uintptr, to uintptr) bool {
 	}
 	return relative
 }
-
-// checkAlreadyPatch 检测是否已经 patch
-func checkAlreadyPatch(origin []byte) bool {
-	return origin[0] == nopOpcode
-}
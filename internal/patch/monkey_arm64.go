@@ -2,6 +2,8 @@ package patch
 
 import (
 	"unsafe"
+
+	"github.com/tencent/goom/internal/bytecode/stub"
 )
 
 const (
@@ -11,9 +13,6 @@ const (
 	_0b100101 = 37 // 0b100101
 )
 
-// nopOpcode 空指令插入到原函数开头第一个字节, 用于判断原函数是否已经被Patch过
-var nopOpcode = []byte{0xD5, 0x03, 0x20, 0x1F}
-
 func jmpToFunctionValue(_, double uintptr) []byte {
 	//func buildJmpDirective(double uintptr) []byte {
 	res := make([]byte, 0, 24)
@@ -46,17 +45,12 @@ func movImm(opc, shift int, val uintptr) []byte {
 	return res
 }
 
+// jmpToNearStub 短跳转到相近的桩函数, 暂不支持
+func jmpToNearStub(_, _ uintptr) ([]byte, *stub.Space) {
+	return nil, nil
+}
+
 // jmpToOriginFunctionValue Assembles a jump to a function value
 func jmpToOriginFunctionValue(_, _ uintptr) (value []byte) {
 	panic("not support yet")
 }
-
-// checkAlreadyPatch 检测是否已经patch
-func checkAlreadyPatch(origin []byte) bool {
-	for i := 0; i < len(nopOpcode); i++ {
-		if origin[i] != nopOpcode[i] {
-			return false
-		}
-	}
-	return true
-}
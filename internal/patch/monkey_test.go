@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tencent/goom/internal/bytecode/memory"
+	"github.com/tencent/goom/internal/bytecode/stub"
 	"github.com/tencent/goom/internal/logger"
 	"github.com/tencent/goom/internal/patch"
 	"github.com/tencent/goom/internal/patch/test"
@@ -91,6 +93,173 @@ func TestUnpatchAll(t *testing.T) {
 	assert.False(t, test.No())
 }
 
+// TestStack 测试同一个函数上叠加 patch, 取消之后恢复为下层的 patch
+func TestStack(t *testing.T) {
+	assert.False(t, test.No())
+	lower, err := patch.Patch(test.No, test.Yes)
+	assert.Nil(t, err)
+	lower.Apply()
+
+	count := 0
+	upper, err := patch.Patch(test.No, func() bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.True(t, test.No(), "lower still active before apply")
+	assert.Equal(t, 0, count)
+	upper.Apply()
+	assert.True(t, test.No())
+	assert.Equal(t, 1, count, "upper active")
+
+	upper.UnpatchWithLock()
+	assert.True(t, test.No(), "restore to lower")
+	assert.Equal(t, 1, count)
+	lower.UnpatchWithLock()
+	assert.False(t, test.No(), "restore to origin")
+
+	// 先取消下层, 上层仍然生效
+	lower, _ = patch.Patch(test.No, test.Yes)
+	lower.Apply()
+	upper, _ = patch.Patch(test.No, func() bool {
+		count++
+		return true
+	})
+	upper.Apply()
+	lower.UnpatchWithLock()
+	assert.True(t, test.No())
+	assert.Equal(t, 2, count, "upper still active")
+	upper.UnpatchWithLock()
+	assert.False(t, test.No())
+}
+
+// TestSuspend 测试暂停和恢复 patch 时保留在栈中的位置
+func TestSuspend(t *testing.T) {
+	lower, err := patch.Patch(test.No, test.Yes)
+	assert.Nil(t, err)
+	lower.Apply()
+	count := 0
+	upper, err := patch.Patch(test.No, func() bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	upper.Apply()
+
+	lower.Suspend()
+	upper.Suspend()
+	assert.False(t, test.No(), "all suspended")
+	lower.Resume()
+	assert.True(t, test.No(), "lower resumed")
+	assert.Equal(t, 0, count)
+	upper.Resume()
+	assert.True(t, test.No())
+	assert.Equal(t, 1, count, "upper still on top after resume")
+
+	upper.UnpatchWithLock()
+	lower.UnpatchWithLock()
+	assert.False(t, test.No())
+}
+
+// TestRestoreAll 测试校验和兜底还原
+func TestRestoreAll(t *testing.T) {
+	guard, err := patch.Patch(test.No, test.Yes)
+	assert.Nil(t, err)
+	guard.Apply()
+	assert.True(t, test.No())
+	assert.Empty(t, patch.Verify())
+
+	assert.Equal(t, 1, patch.RestoreAll())
+	assert.False(t, test.No(), "restore to origin")
+	assert.Empty(t, patch.Active())
+	guard.UnpatchWithLock()
+	assert.False(t, test.No(), "unpatch after restore all")
+}
+
+// TestBatch 测试批量写入
+func TestBatch(t *testing.T) {
+	assert.True(t, patch.BeginBatch())
+	assert.False(t, patch.BeginBatch(), "nested batch")
+	guard, err := patch.Patch(test.No, test.Yes)
+	assert.Nil(t, err)
+	guard.Apply()
+	assert.False(t, test.No(), "not written before commit")
+	assert.Nil(t, patch.CommitBatch())
+	assert.True(t, test.No(), "written after commit")
+
+	assert.True(t, patch.BeginBatch())
+	guard.UnpatchWithLock()
+	assert.True(t, test.No(), "not written before rollback")
+	patch.RollbackBatch()
+	assert.False(t, test.No(), "restore to origin")
+
+	// 批量写入中取消之后重新 patch, 登记的原始指令不能是还没有移除的跳转指令
+	guard, _ = patch.Patch(test.No, test.Yes)
+	guard.Apply()
+	assert.True(t, patch.BeginBatch())
+	guard.Release()
+	guard, err = patch.Patch(test.No, test.Yes)
+	assert.Nil(t, err)
+	guard.Apply()
+	assert.Nil(t, patch.CommitBatch())
+	assert.True(t, test.No(), "repatch in batch")
+	guard.Release()
+	assert.False(t, test.No(), "restore to origin after repatch")
+}
+
+// TestWriteStrategy 测试替代 mprotect 的写入方式
+func TestWriteStrategy(t *testing.T) {
+	defer func() {
+		assert.Nil(t, memory.UseStrategy(memory.StrategyMprotect))
+	}()
+	for _, s := range []memory.Strategy{memory.StrategyProcMem, memory.StrategyMemfd} {
+		if err := memory.UseStrategy(s); err != nil {
+			t.Logf("skip %s: %v", s, err)
+			continue
+		}
+		assert.Equal(t, s, memory.CurrentStrategy())
+		guard, err := patch.Patch(test.No, test.Yes)
+		assert.Nil(t, err)
+		guard.Apply()
+		assert.True(t, test.No(), "patched by %s", s)
+		guard.UnpatchWithLock()
+		assert.False(t, test.No(), "unpatched by %s", s)
+	}
+}
+
+// TestNearJump 测试短跳转指令, 释放的桩函数不再复用
+func TestNearJump(t *testing.T) {
+	guard, err := patch.Patch(test.Yes, func() bool { return false })
+	assert.Nil(t, err)
+	guard.Apply()
+	assert.False(t, test.Yes(), "patched check")
+	if runtime.GOARCH == "amd64" {
+		code := memory.RawRead(reflect.ValueOf(test.Yes).Pointer(), 1)
+		assert.Equal(t, byte(0xe9), code[0], "rel32 jmp check")
+	}
+
+	before := stub.ReadStats()
+	guard.Release()
+	assert.True(t, test.Yes(), "released check")
+	guard.Apply()
+	assert.True(t, test.Yes(), "apply after release check")
+	if runtime.GOARCH != "amd64" {
+		return
+	}
+	released := stub.ReadStats()
+	assert.Equal(t, before.InUse-1, released.InUse, "stub released check")
+	assert.Equal(t, before.Retired+1, released.Retired, "stub retired check")
+	assert.Equal(t, before.Free, released.Free, "stub not free check")
+
+	guard, err = patch.Patch(test.Yes, func() bool { return false })
+	assert.Nil(t, err)
+	guard.Apply()
+	assert.False(t, test.Yes(), "patched again check")
+	assert.Equal(t, released.Reused, stub.ReadStats().Reused, "stub not reused check")
+	guard.Release()
+	assert.True(t, test.Yes())
+}
+
 // TestWithInstanceMethod 测试实例方法
 func TestWithInstanceMethod(t *testing.T) {
 	i := &test.S{}
@@ -5,15 +5,17 @@ import (
 	"errors"
 	"reflect"
 	"runtime"
+	"sort"
 	"sync"
 
 	"github.com/tencent/goom/internal/bytecode"
+	"github.com/tencent/goom/internal/bytecode/stub"
 	"github.com/tencent/goom/internal/logger"
 )
 
 var (
-	// patches 缓存
-	patches = make(map[uintptr]*patch)
+	// patches 缓存, 同一个函数的多个 patch 按照创建顺序入栈, 栈顶已应用的 patch 生效
+	patches = make(map[uintptr][]*Guard)
 	// lock patches 缓存的读写锁定
 	patchesLock = sync.Mutex{}
 )
@@ -45,6 +47,8 @@ type patch struct {
 
 	originBytes []byte
 	jumpBytes   []byte
+	// jumpStub 短跳转指令跳转到的桩函数
+	jumpStub *stub.Space
 
 	guard *Guard
 }
@@ -99,48 +103,126 @@ func (p *patch) unsafePatchPtr() error {
 }
 
 // replaceFunc 替换函数
+// 同一个函数已经存在 patch 时, 新的 patch 压入栈顶, 取消之后恢复为下层的 patch
 func (p *patch) replaceFunc() error {
 	lock()
 	defer unlock()
 
-	if _, ok := patches[p.originPtr]; ok {
-		unpatchValue(p.originPtr)
+	// 同一个函数上已有 patch 时, 使用栈底 patch 登记的原始指令和跳转指令长度, 不读取已经被改写的内存
+	// 批量写入中取消的 patch 的跳转指令还没有从内存中移除, 同样使用批量写入登记的原始指令
+	var (
+		width    int
+		recorded []byte
+	)
+	if stack := patches[p.originPtr]; len(stack) > 0 {
+		width = len(stack[0].jumpBytes)
+		recorded = stack[0].originBytes
+	} else if b := currentBatch(); b != nil && b.dirty[p.originPtr] != nil {
+		recorded = b.dirty[p.originPtr]
+		width = len(recorded)
 	}
-	patches[p.originPtr] = p
 
 	replacementInAddr := (uintptr)(bytecode.GetPtr(p.replacementValue))
-	jumpData, err := genJumpData(p.originPtr, replacementInAddr, p.replacementPtr)
+	jumpData, jumpStub, err := genJumpData(p.originPtr, replacementInAddr, p.replacementPtr, width)
 	if err != nil {
 		if errors.Unwrap(err) == errAlreadyPatch {
-			if pc, ok := patches[p.originPtr]; ok {
-				bytecode.PrintInstf("origin bytes", pc.originPtr, pc.originBytes, logger.WarningLevel)
+			if stack := patches[p.originPtr]; len(stack) > 0 {
+				bytecode.PrintInstf("origin bytes", p.originPtr, stack[0].originBytes, logger.WarningLevel)
 			}
 		}
 		return err
 	}
 	p.jumpBytes = jumpData
 
-	originBytes, err := checkAndReadOriginBytes(p.originPtr, len(jumpData))
-	if err != nil {
-		return err
+	if recorded != nil {
+		p.originBytes = recorded
+	} else {
+		originBytes, err := checkAndReadOriginBytes(p.originPtr, jumpData)
+		if err != nil {
+			stub.Release(jumpStub)
+			return err
+		}
+		p.originBytes = originBytes
 	}
-	p.originBytes = originBytes
 
 	// 是否修复指令
 	if p.trampolinePtr > 0 {
-		fixOriginPtr, err := fixOrigin(p.originPtr, p.trampolinePtr, len(jumpData))
+		fixOriginPtr, err := fixOrigin(p.originPtr, p.trampolinePtr, len(jumpData), recorded)
 		if err != nil {
+			stub.Release(jumpStub)
 			return err
 		}
 		p.fixOriginPtr = fixOriginPtr
 	}
+	p.jumpStub = jumpStub
+
+	patches[p.originPtr] = append(patches[p.originPtr], p.Guard())
+	return nil
+}
 
+// activeGuard 获取函数当前生效的 patch, 即栈中最上层的已应用且未暂停的 patch, 需要加锁调用
+func activeGuard(origin uintptr) *Guard {
+	stack := patches[origin]
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].applied && !stack[i].suspended {
+			return stack[i]
+		}
+	}
 	return nil
 }
 
-// unpatch do unpatch by uint ptr
-func (p *patch) unpatch() {
-	p.Guard().Unpatch()
+// Active 获取所有已应用的 patch, 按照函数地址和入栈顺序排序
+func Active() []*Guard {
+	lock()
+	defer unlock()
+
+	var result []*Guard
+	for _, origin := range sortedOrigins() {
+		for _, g := range patches[origin] {
+			if g.applied {
+				result = append(result, g)
+			}
+		}
+	}
+	return result
+}
+
+// sortedOrigins 所有 patch 过的函数地址, 按照地址排序, 需要加锁调用
+func sortedOrigins() []uintptr {
+	origins := make([]uintptr, 0, len(patches))
+	for origin := range patches {
+		origins = append(origins, origin)
+	}
+	sort.Slice(origins, func(i, j int) bool {
+		return origins[i] < origins[j]
+	})
+	return origins
+}
+
+// push 将 patch 压入栈顶, 已经在栈中时不做处理, 需要加锁调用
+func push(g *Guard) {
+	for _, item := range patches[g.origin] {
+		if item == g {
+			return
+		}
+	}
+	patches[g.origin] = append(patches[g.origin], g)
+}
+
+// remove 将 patch 移出栈, 需要加锁调用
+func remove(g *Guard) {
+	stack := patches[g.origin]
+	for i, item := range stack {
+		if item == g {
+			stack = append(stack[:i:i], stack[i+1:]...)
+			break
+		}
+	}
+	if len(stack) == 0 {
+		delete(patches, g.origin)
+		return
+	}
+	patches[g.origin] = stack
 }
 
 // Guard 获取 PatchGuard
@@ -152,7 +234,10 @@ func (p *patch) Guard() *Guard {
 		origin:       p.originPtr,
 		originBytes:  p.originBytes,
 		jumpBytes:    p.jumpBytes,
+		originSum:    checksum(p.originBytes),
+		jumpSum:      checksum(p.jumpBytes),
 		fixOriginPtr: p.fixOriginPtr,
+		jumpStub:     p.jumpStub,
 		applied:      false,
 	}
 	return p.guard
@@ -37,7 +37,7 @@ func Func(funcDef interface{}, proxyFunc, trampolineFunc interface{}) (*patch.Gu
 		_, err = unexports2.CreateFuncForCodePtr(trampolineFunc, patchGuard.FixOriginFunc())
 		if err != nil {
 			logger.Error("func proxy fail funcDef=", funcDef, ":", err)
-			patchGuard.Unpatch()
+			patchGuard.Release()
 			return nil, err
 		}
 	}
@@ -98,7 +98,7 @@ func Method(target reflect.Type, methodName string, proxyFunc,
 		_, err = unexports2.CreateFuncForCodePtr(trampolineFunc, patchGuard.FixOriginFunc())
 		if err != nil {
 			logger.Error("method proxy fail method=", target, ".", methodName, ":", err)
-			patchGuard.Unpatch()
+			patchGuard.Release()
 			return nil, err
 		}
 	}
@@ -45,7 +45,7 @@ func Interface(ifaceVar interface{}, ctx *iface.IContext, method string, imp int
 	// mock 接口方法
 	var itabFunc = iface.GenCallableMethod(ctx, imp, proxy)
 	// 上下文中查找接口代理对象的缓存
-	ifaceCacheKey := typ.PkgPath() + "/" + typ.String()
+	ifaceCacheKey := iface.CacheKey(typ)
 	if fakeIface, ok := ctx.Cached(ifaceCacheKey); ok && !ctx.Canceled() {
 		// 添加代理函数到 funcTab
 		fakeIface.Tab.Fun[funcTabIndex] = itabFunc
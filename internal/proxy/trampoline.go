@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"reflect"
+
+	"github.com/tencent/goom/internal/bytecode/stub"
+	"github.com/tencent/goom/internal/logger"
+	"github.com/tencent/goom/internal/unexports2"
+)
+
+// trampolineSize 自动生成的跳板函数的空间大小
+// 占位函数的指令长度为 3, 保持对齐以便能正确计算跳板函数的长度
+const trampolineSize = 3 * 64
+
+// AutoTrampoline 自动生成跳板函数, 无需调用方定义占位的原函数
+// typ 原函数类型
+// return 跳板函数指针(*func), 可以作为 Func、Method 的 trampolineFunc 参数
+func AutoTrampoline(typ reflect.Type) (interface{}, error) {
+	space, err := stub.AcquireNear(trampolineSize)
+	if err != nil {
+		logger.Error("auto trampoline acquire space fail:", err)
+		return nil, err
+	}
+	trampoline := reflect.New(typ)
+	trampoline.Elem().Set(unexports2.NewFuncWithCodePtr(typ, space.Addr))
+	return trampoline.Interface(), nil
+}
+
+// ReleaseTrampoline 回收自动生成的跳板函数的空间, 之后生成跳板函数时复用
+// addr 跳板函数的指令地址, 调用方需要保证跳板函数已经不再被 patch 使用并且没有进行中的调用
+func ReleaseTrampoline(addr uintptr) bool {
+	return stub.ReleaseAddr(addr)
+}
+
+// RetireTrampoline 回收自动生成的跳板函数的空间, 之后不再复用
+// addr 跳板函数的指令地址, 用于跳板函数已经拷贝给调用方, 回收之后仍然可能被调用的场景
+func RetireTrampoline(addr uintptr) bool {
+	return stub.RetireAddr(addr)
+}
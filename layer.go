@@ -0,0 +1,164 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了可叠加的拦截层, 支持了 mock.Func(foo).Before(...)、.After(...)、.Around(...),
+// 多个互相独立的使用方(比如链路追踪和故障注入)可以在同一个函数上叠加拦截层, 并且单独取消。
+package mocker
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AroundFunc 环绕拦截函数, 通过 next 调用内层(内层拦截层、mock 实现或者原函数), 可以修改参数和返回值
+type AroundFunc func(args []interface{}, next func(args []interface{}) []interface{}) []interface{}
+
+// Layer 拦截层
+// 同一个函数上先添加的拦截层在外层: Before 按照添加的顺序执行, After 按照添加的逆序执行
+// 拦截层包裹在 mock 实现之外, 没有 mock 实现时包裹原函数; 方法的参数包含接收体
+type Layer struct {
+	name    string
+	hub     *patchHub
+	scope   *mockScope
+	funcTyp reflect.Type
+	owner   *baseMocker
+
+	before func(args []interface{})
+	after  func(args, results []interface{})
+	around AroundFunc
+
+	canceled bool
+	// suspended 是否被暂停, 暂停的拦截层不执行
+	suspended bool
+}
+
+// String 拦截层的描述
+func (l *Layer) String() string {
+	return l.name
+}
+
+// Cancel 取消拦截层, 不影响同一个函数上的其他拦截层和 mock 实现
+func (l *Layer) Cancel() {
+	if l.canceled {
+		return
+	}
+	l.canceled = true
+	l.hub.lock.Lock()
+	for i, item := range l.hub.layers {
+		if item == l {
+			l.hub.layers = append(l.hub.layers[:i:i], l.hub.layers[i+1:]...)
+			break
+		}
+	}
+	l.hub.lock.Unlock()
+	l.hub.release(l.owner.inflightTimeout())
+}
+
+// Canceled 是否已经被取消
+func (l *Layer) Canceled() bool {
+	return l.canceled
+}
+
+// invoke 执行拦截层, next 调用内层
+func (l *Layer) invoke(args []reflect.Value, next func([]reflect.Value) []reflect.Value) []reflect.Value {
+	switch {
+	case l.before != nil:
+		l.before(values(args))
+		return next(args)
+	case l.after != nil:
+		results := next(args)
+		l.after(values(args), values(results))
+		return results
+	default:
+		results := l.around(values(args), func(in []interface{}) []interface{} {
+			return values(next(toValues(in, inTypes(false, l.funcTyp), "args")))
+		})
+		return toValues(results, outTypes(l.funcTyp), "results")
+	}
+}
+
+// runLayers 由外向内依次执行拦截层, 最后调用 inner
+func runLayers(layers []*Layer, inner reflect.Value, args []reflect.Value) []reflect.Value {
+	if len(layers) == 0 {
+		return callValue(inner, args)
+	}
+	return layers[0].invoke(args, func(in []reflect.Value) []reflect.Value {
+		return runLayers(layers[1:], inner, in)
+	})
+}
+
+// addLayer 在目标函数上添加拦截层
+func (m *baseMocker) addLayer(name string, target patchTarget, funcTyp reflect.Type, l *Layer) *Layer {
+	hubLock.Lock()
+	h := hubOf(target, funcTyp, m.site)
+	hubLock.Unlock()
+
+	l.name = name
+	l.hub = h
+	l.funcTyp = funcTyp
+	l.owner = m
+	if m.scoped() {
+		l.scope = m.builder.scope
+	}
+	h.lock.Lock()
+	h.layers = append(h.layers, l)
+	h.lock.Unlock()
+	m.layers = append(m.layers, l)
+	return l
+}
+
+// cancelLayers 取消 mocker 添加的所有拦截层
+func (m *baseMocker) cancelLayers() {
+	for _, l := range m.layers {
+		l.Cancel()
+	}
+	m.layers = nil
+}
+
+// Before 添加在调用之前执行的拦截层
+func (m *DefMocker) Before(fn func(args []interface{})) *Layer {
+	return m.addLayer("before:"+m.String(), m.target(), reflect.TypeOf(m.funcDef), &Layer{before: fn})
+}
+
+// After 添加在调用返回之后执行的拦截层, 调用 panic 时不执行
+func (m *DefMocker) After(fn func(args, results []interface{})) *Layer {
+	return m.addLayer("after:"+m.String(), m.target(), reflect.TypeOf(m.funcDef), &Layer{after: fn})
+}
+
+// Around 添加环绕调用的拦截层
+func (m *DefMocker) Around(fn AroundFunc) *Layer {
+	return m.addLayer("around:"+m.String(), m.target(), reflect.TypeOf(m.funcDef), &Layer{around: fn})
+}
+
+// Before 添加在调用之前执行的拦截层
+func (m *MethodMocker) Before(fn func(args []interface{})) *Layer {
+	return m.addLayer("before:"+m.String(), m.target(), reflect.TypeOf(m.methodIns), &Layer{before: fn})
+}
+
+// After 添加在调用返回之后执行的拦截层, 调用 panic 时不执行
+func (m *MethodMocker) After(fn func(args, results []interface{})) *Layer {
+	return m.addLayer("after:"+m.String(), m.target(), reflect.TypeOf(m.methodIns), &Layer{after: fn})
+}
+
+// Around 添加环绕调用的拦截层
+func (m *MethodMocker) Around(fn AroundFunc) *Layer {
+	return m.addLayer("around:"+m.String(), m.target(), reflect.TypeOf(m.methodIns), &Layer{around: fn})
+}
+
+// toValues 将[]interface{} 转换为指定类型的[]reflect.Value, nil 转换为零值
+func toValues(vs []interface{}, types []reflect.Type, kind string) []reflect.Value {
+	if len(vs) != len(types) {
+		panic(fmt.Sprintf("%s count not match, required %d, actual %d", kind, len(types), len(vs)))
+	}
+	result := make([]reflect.Value, len(vs))
+	for i, v := range vs {
+		if v == nil {
+			result[i] = reflect.Zero(types[i])
+			continue
+		}
+		result[i] = reflect.ValueOf(v)
+		if !result[i].Type().AssignableTo(types[i]) {
+			panic(fmt.Sprintf("%s[%d] type not match, required %s, actual %s", kind, i, types[i], result[i].Type()))
+		}
+	}
+	return result
+}
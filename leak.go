@@ -0,0 +1,168 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 patch 泄漏检测, 支持了 mocker.ActivePatches() 查询生效中的 patch,
+// 以及在 TestMain 或单测结束时校验没有遗留的 patch, 避免忘记 Reset 影响同一个二进制中后续的单测。
+package mocker
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/tencent/goom/internal/logger"
+	"github.com/tencent/goom/internal/patch"
+)
+
+// ActivePatch 生效中的 patch
+type ActivePatch struct {
+	// Func 被 patch 的函数名称
+	Func string
+	// Mocker 创建 patch 的 mocker 描述, 不是通过 mocker 创建时为空
+	Mocker string
+	// Site mocker 声明的代码位置, 格式为 file:line
+	Site string
+
+	guard *patch.Guard
+	owner *patchOwner
+}
+
+// String patch 的描述
+func (p *ActivePatch) String() string {
+	if p.Mocker == "" {
+		return fmt.Sprintf("patch [%s]", p.Func)
+	}
+	return fmt.Sprintf("mocker [%s] declared at %s", p.Mocker, p.Site)
+}
+
+// ActivePatches 获取所有生效中的 patch
+func ActivePatches() []*ActivePatch {
+	guards := patch.Active()
+	hubLock.Lock()
+	defer hubLock.Unlock()
+
+	result := make([]*ActivePatch, 0, len(guards))
+	for _, g := range guards {
+		p := &ActivePatch{guard: g, owner: patchOwners[g]}
+		if f := runtime.FuncForPC(g.Origin()); f != nil {
+			p.Func = f.Name()
+		}
+		if p.owner != nil {
+			p.Mocker = p.owner.name
+			p.Site = p.owner.site
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// restore 还原泄漏的 patch, 并清理 mocker 的 patch 记录
+func (p *ActivePatch) restore() {
+	hubLock.Lock()
+	if p.owner != nil {
+		if p.owner.shared {
+			if h, ok := hubs[p.owner.key]; ok && h.guard == p.guard {
+				delete(hubs, p.owner.key)
+			}
+		} else {
+			for _, m := range plainPatches[p.owner.key] {
+				if m.guard.(*plainMockGuard).guard.patchGuard == p.guard {
+					removePlain(p.owner.key, m)
+					break
+				}
+			}
+		}
+		delete(patchOwners, p.guard)
+	}
+	hubLock.Unlock()
+	p.guard.UnpatchWithLock()
+}
+
+// TestingM 运行所有单测, testing.M 实现了该接口
+type TestingM interface {
+	Run() int
+}
+
+// LeakT 单测结束时校验泄漏, testing.T 实现了该接口
+type LeakT interface {
+	TestingT
+	Cleanup(func())
+}
+
+// LeakOption 泄漏检测选项
+type LeakOption func(*leakOptions)
+
+// leakOptions 泄漏检测选项
+type leakOptions struct {
+	autoRestore bool
+}
+
+// AutoRestore 发现泄漏时自动还原 patch 并打印告警, 不再报告失败
+func AutoRestore() LeakOption {
+	return func(o *leakOptions) {
+		o.autoRestore = true
+	}
+}
+
+// newLeakOptions 创建泄漏检测选项
+func newLeakOptions(opts []LeakOption) *leakOptions {
+	o := &leakOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// VerifyNoLeaks 运行所有单测, 结束之后校验没有遗留的 patch, 有遗留时退出码为 1, 在 TestMain 中使用
+// 比如: func TestMain(m *testing.M) { mocker.VerifyNoLeaks(m) }
+func VerifyNoLeaks(m TestingM, opts ...LeakOption) {
+	code := m.Run()
+	if err := handleLeaks(ActivePatches(), newLeakOptions(opts)); err != "" {
+		fmt.Fprintf(os.Stderr, "goom: patches leaked after all tests:\n%s\n", err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// VerifyNoLeaksT 单测结束时校验当前单测中创建的 patch 都已经取消, 需要在单测开始时调用
+// 通过 t.Cleanup 注册, 在之后注册的 Cleanup(比如 mocker.CreateT) 执行之后校验
+func VerifyNoLeaksT(t LeakT, opts ...LeakOption) {
+	existing := make(map[*patch.Guard]bool)
+	for _, p := range ActivePatches() {
+		existing[p.guard] = true
+	}
+	o := newLeakOptions(opts)
+	t.Cleanup(func() {
+		var leaks []*ActivePatch
+		for _, p := range ActivePatches() {
+			if !existing[p.guard] {
+				leaks = append(leaks, p)
+			}
+		}
+		if err := handleLeaks(leaks, o); err != "" {
+			t.Errorf("patches leaked after test:\n%s", err)
+		}
+	})
+}
+
+// handleLeaks 处理泄漏的 patch, 自动还原时返回空, 否则返回泄漏的描述
+func handleLeaks(leaks []*ActivePatch, o *leakOptions) string {
+	if len(leaks) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(leaks))
+	for _, p := range leaks {
+		lines = append(lines, "\t"+p.String())
+	}
+	desc := strings.Join(lines, "\n")
+	if !o.autoRestore {
+		return desc
+	}
+	for i := len(leaks) - 1; i >= 0; i-- {
+		leaks[i].restore()
+	}
+	logger.Consolef(logger.WarningLevel, "restored leaked patches:\n%s", desc)
+	return ""
+}
@@ -0,0 +1,424 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了从 YAML 或 JSON 文件加载 mock 定义, 支持数据驱动测试。
+package mocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/erro"
+	"github.com/tencent/goom/internal/unexports2"
+)
+
+// anyHint 匹配任意参数的占位值, 等同于 arg.Any()
+const anyHint = "$any"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Target 未导出函数(或方法)的定义, 用于 LoadFile 确定参数和返回值类型
+// 比如: Target{Name: "github.com/xx/pkg.(*conn).read", Func: func(c *fakeConn, n int) ([]byte, error) {...}}
+type Target struct {
+	// Name 函数(或方法)的完整符号名称
+	Name string
+	// Func 函数原型, 签名需要和原函数保持一致, 方法的第一个参数为接收体
+	Func interface{}
+}
+
+// mockEntry 文件中的一条 mock 定义
+type mockEntry struct {
+	// Target mock 的目标符号, 比如 pkg.Foo、pkg.(*T).M
+	Target string `yaml:"target" json:"target"`
+	// When 参数条件
+	When interface{} `yaml:"when" json:"when"`
+	// Return 返回值
+	Return interface{} `yaml:"return" json:"return"`
+	// Returns 依次按顺序的返回值
+	Returns []interface{} `yaml:"returns" json:"returns"`
+	// Delay 返回前的延迟, 比如 100ms
+	Delay string `yaml:"delay" json:"delay"`
+	// Panic 抛出的 panic
+	Panic interface{} `yaml:"panic" json:"panic"`
+
+	// line 定义所在的行号
+	line int
+}
+
+// LoadFile 从 YAML 或 JSON 文件加载 mock 定义, 根据文件扩展名(.json)区分格式
+// defs 导出函数(或方法表达式, 比如 (*T).M)的定义, 以及未导出函数的 Target 定义, 用于确定参数和返回值的类型
+// target 和 Target.Name 可以省略包路径, 比如 pkg.Foo、Foo、(*T).M, 按照名称唯一匹配 defs 和符号表中的函数
+// 每条定义使用 target 指定目标符号, 使用 when/return/returns/delay/panic 指定 mock 行为, 比如:
+//
+//   - target: github.com/xx/pkg.Foo
+//     when: [1]
+//     return: [3]
+//     delay: 10ms
+func LoadFile(b *Builder, path string, defs ...interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return erro.NewLoadFailedError(path, 0, "", err)
+	}
+
+	var entries []*mockEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries, err = decodeJSONEntries(data)
+	} else {
+		entries, err = decodeYAMLEntries(data)
+	}
+	if err != nil {
+		return erro.NewLoadFailedError(path, 0, "", err)
+	}
+
+	targets, err := targetDefs(defs)
+	if err != nil {
+		return erro.NewLoadFailedError(path, 0, "", err)
+	}
+	// 在 mocker 包内构造 mocker 时 builder 会重置为 mocker 包, 加载之后恢复为调用方指定的包
+	pkgName := b.pkgName
+	defer b.Pkg(pkgName)
+	for _, e := range entries {
+		if err := e.apply(b, targets); err != nil {
+			return erro.NewLoadFailedError(path, e.line, e.Target, err)
+		}
+	}
+	return nil
+}
+
+// targetDefs 按照符号名称索引函数定义
+func targetDefs(defs []interface{}) (map[string]interface{}, error) {
+	targets := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		var t Target
+		switch d := def.(type) {
+		case Target:
+			t = d
+		case *Target:
+			t = *d
+		default:
+			if reflect.TypeOf(def) == nil || reflect.TypeOf(def).Kind() != reflect.Func {
+				return nil, fmt.Errorf("def must be func or mocker.Target, actual %T", def)
+			}
+			targets[functionName(def)] = def
+			continue
+		}
+		name, err := resolveSymbol(t.Name)
+		if err != nil {
+			return nil, err
+		}
+		t.Name = name
+		targets[name] = t
+	}
+	return targets, nil
+}
+
+// decodeJSONEntries 解析 JSON 格式的定义, 并记录每条定义所在的行号
+func decodeJSONEntries(data []byte) ([]*mockEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, errors.New("mock definitions must be a JSON array")
+	}
+
+	var entries []*mockEntry
+	for dec.More() {
+		offset := dec.InputOffset()
+		e := &mockEntry{}
+		if err := dec.Decode(e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, offset), err)
+		}
+		// InputOffset 指向上一个 token 的结尾, 跳过分隔符和空白得到定义的起始位置
+		e.line = lineAt(data, offset+int64(len(data[offset:])-len(bytes.TrimLeft(data[offset:], ", \t\r\n"))))
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// decodeYAMLEntries 解析 YAML 格式的定义, 并记录每条定义所在的行号
+func decodeYAMLEntries(data []byte) ([]*mockEntry, error) {
+	var entries []*mockEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	lines := yamlItemLines(data)
+	if len(lines) == len(entries) {
+		for i, e := range entries {
+			e.line = lines[i]
+		}
+	}
+	return entries, nil
+}
+
+// yamlItemLines 顶层列表元素所在的行号
+func yamlItemLines(data []byte) []int {
+	var (
+		lines  []int
+		indent = -1
+	)
+	for i, l := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(l, " ")
+		if !strings.HasPrefix(trimmed, "- ") && trimmed != "-" {
+			continue
+		}
+		cur := len(l) - len(trimmed)
+		if indent < 0 {
+			indent = cur
+		}
+		if cur == indent {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// lineAt 计算偏移量所在的行号
+func lineAt(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// apply 应用一条 mock 定义
+func (e *mockEntry) apply(b *Builder, targets map[string]interface{}) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	mocker, funcTyp, err := e.mocker(b, targets)
+	if err != nil {
+		return err
+	}
+
+	var w *When
+	if e.When != nil {
+		args, err := convertValues(listOf(e.When), inTypes(false, funcTyp), "when")
+		if err != nil {
+			return err
+		}
+		w = mocker.When(args...)
+	}
+	outs := outTypes(funcTyp)
+	if e.Return != nil {
+		results, err := convertValues(listOf(e.Return), outs, "return")
+		if err != nil {
+			return err
+		}
+		w = returnOf(mocker, w, results...)
+	}
+	for i, r := range e.Returns {
+		results, err := convertValues(listOf(r), outs, fmt.Sprintf("returns[%d]", i))
+		if err != nil {
+			return err
+		}
+		if w != nil && i > 0 {
+			w.AndReturn(results...)
+		} else {
+			w = returnOf(mocker, w, results...)
+		}
+	}
+	if w == nil {
+		w = mocker.Returns()
+	}
+
+	if e.Delay != "" {
+		d, err := time.ParseDuration(e.Delay)
+		if err != nil {
+			return fmt.Errorf("delay: %w", err)
+		}
+		w.Delay(d)
+	}
+	if e.Panic != nil {
+		w.Panic(e.Panic)
+	}
+	return nil
+}
+
+// mocker 根据目标符号创建 mocker
+func (e *mockEntry) mocker(b *Builder, targets map[string]interface{}) (ExportedMocker, reflect.Type, error) {
+	def, err := lookupDef(targets, e.Target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if def == nil {
+		if _, err := resolveSymbol(e.Target); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("symbol definition not found, pass the func or mocker.Target to LoadFile")
+	}
+
+	t, ok := def.(Target)
+	if !ok {
+		return b.Func(def), reflect.TypeOf(def), nil
+	}
+	if reflect.TypeOf(t.Func) == nil || reflect.TypeOf(t.Func).Kind() != reflect.Func {
+		return nil, nil, fmt.Errorf("target func must be func, actual %T", t.Func)
+	}
+	if _, err := unexports2.FindFuncByName(t.Name); err != nil {
+		return nil, nil, fmt.Errorf("unknown symbol: %w", err)
+	}
+	pkg, name := splitSymbol(t.Name)
+	return b.Pkg(pkg).ExportFunc(name).As(t.Func), reflect.TypeOf(t.Func), nil
+}
+
+// lookupDef 按照符号名称查找定义, 名称省略包路径时必须唯一匹配, 没有找到时返回 nil
+func lookupDef(targets map[string]interface{}, name string) (interface{}, error) {
+	if def, ok := targets[name]; ok {
+		return def, nil
+	}
+	var matched []string
+	for symbol := range targets {
+		if matchSymbol(symbol, name) {
+			matched = append(matched, symbol)
+		}
+	}
+	if len(matched) > 1 {
+		sort.Strings(matched)
+		return nil, fmt.Errorf("ambiguous symbol, matches %s", strings.Join(matched, ", "))
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	return targets[matched[0]], nil
+}
+
+// resolveSymbol 将省略包路径的符号名称解析为完整的符号名称, 名称必须在符号表中唯一匹配
+func resolveSymbol(name string) (string, error) {
+	if _, err := unexports2.FindFuncByName(name); err == nil {
+		return name, nil
+	}
+	funcs, err := unexports2.AllFunctions()
+	if err != nil {
+		return "", fmt.Errorf("unknown symbol: %w", err)
+	}
+	var matched []string
+	for symbol := range funcs {
+		if matchSymbol(symbol, name) {
+			matched = append(matched, symbol)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("unknown symbol: %s", name)
+	case 1:
+		return matched[0], nil
+	default:
+		sort.Strings(matched)
+		return "", fmt.Errorf("ambiguous symbol, matches %s", strings.Join(matched, ", "))
+	}
+}
+
+// matchSymbol 完整的符号名称是否和省略包路径的名称匹配
+// 比如 github.com/xx/pkg.(*T).M 匹配 pkg.(*T).M 和 (*T).M
+func matchSymbol(symbol, name string) bool {
+	if symbol == name || strings.HasSuffix(symbol, "/"+name) {
+		return true
+	}
+	_, local := splitSymbol(symbol)
+	return local == name
+}
+
+// returnOf 指定返回值, 未指定条件时作为默认返回值
+func returnOf(m ExportedMocker, w *When, results ...interface{}) *When {
+	if w == nil {
+		return m.Return(results...)
+	}
+	return w.Return(results...)
+}
+
+// splitSymbol 将符号名称拆分为包路径和包内名称, 比如 github.com/xx/pkg.(*T).M => github.com/xx/pkg, (*T).M
+func splitSymbol(symbol string) (string, string) {
+	slash := strings.LastIndex(symbol, "/")
+	dot := strings.Index(symbol[slash+1:], ".")
+	if dot < 0 {
+		return "", symbol
+	}
+	return symbol[:slash+1+dot], symbol[slash+2+dot:]
+}
+
+// listOf 将单个值包装为列表
+func listOf(v interface{}) []interface{} {
+	if l, ok := v.([]interface{}); ok {
+		return l
+	}
+	return []interface{}{v}
+}
+
+// convertValues 将文件中的值转换为参数或返回值的类型
+func convertValues(vs []interface{}, types []reflect.Type, kind string) ([]interface{}, error) {
+	if len(vs) != len(types) {
+		return nil, fmt.Errorf("%s count not match, required %d, actual %d", kind, len(types), len(vs))
+	}
+	result := make([]interface{}, len(vs))
+	for i, v := range vs {
+		if v == anyHint {
+			result[i] = arg.Any()
+			continue
+		}
+		cv, err := convertValue(v, types[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d] %s: %w", kind, i, types[i], err)
+		}
+		result[i] = cv
+	}
+	return result, nil
+}
+
+// convertValue 将文件中的值转换为指定类型
+func convertValue(v interface{}, typ reflect.Type) (interface{}, error) {
+	if v == nil {
+		return reflect.Zero(typ).Interface(), nil
+	}
+	if s, ok := v.(string); ok {
+		switch typ {
+		case errorType:
+			return errors.New(s), nil
+		case durationType:
+			return time.ParseDuration(s)
+		case bytesType:
+			return []byte(s), nil
+		}
+	}
+
+	data, err := json.Marshal(normalize(v))
+	if err != nil {
+		return nil, err
+	}
+	out := reflect.New(typ)
+	if err := json.Unmarshal(data, out.Interface()); err != nil {
+		return nil, err
+	}
+	return out.Elem().Interface(), nil
+}
+
+// normalize 将 YAML 解析的 map[interface{}]interface{} 转换为 map[string]interface{}, 以便 JSON 序列化
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[fmt.Sprintf("%v", k)] = normalize(item)
+		}
+		return m
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalize(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalize(item)
+		}
+		return val
+	}
+	return v
+}
@@ -3,36 +3,60 @@ package mocker
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"sync/atomic"
+	"time"
 
 	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/erro"
 )
 
 // BaseMatcher 参数匹配基类
 type BaseMatcher struct {
+	// name mocker 名称, 用于错误提示
+	name    string
 	results [][]reflect.Value
 	curNum  int32
 	funTyp  reflect.Type
 	// resultsPtr 持有参数指针, 防止被回收
 	resultsPtr []interface{}
+	// outArgs 匹配成功后需要写入的出参
+	outArgs []*arg.OutArg
+	// inStates 匹配需要满足的状态条件
+	inStates []*stateClause
+	// transitions 匹配成功后的状态迁移
+	transitions []*stateClause
+	// delay 匹配成功后返回前的延迟
+	delay time.Duration
+	// panicValue 匹配成功后抛出的 panic, 为 nil 时正常返回
+	panicValue interface{}
+	// callers 调用方条件, 调用栈中任意一帧的函数名匹配时条件才生效
+	callers []*regexp.Regexp
+	// site 条件声明的代码位置
+	site string
+	// hits 匹配成功的次数
+	hits int64
 }
 
 // newBaseMatcher 创建新参数匹配基类
-func newBaseMatcher(results []interface{}, funTyp reflect.Type) *BaseMatcher {
+// name mocker 名称, 用于错误提示
+func newBaseMatcher(name string, results []interface{}, funTyp reflect.Type) *BaseMatcher {
 	resultVs := make([][]reflect.Value, 0)
 	if results != nil {
 		// TODO results check
 		result, err := arg.I2V(results, outTypes(funTyp))
 		if err != nil {
-			panic("Return Value (" + fmt.Sprintf("%v", results) + ") error: " + err.Error())
+			panic("Return Value (" + fmt.Sprintf("%v", results) + ") error: " + withMocker(err, name, "return").Error())
 		}
 		resultVs = append(resultVs, result)
 	}
 	return &BaseMatcher{
+		name:       name,
 		results:    resultVs,
 		curNum:     0,
 		funTyp:     funTyp,
 		resultsPtr: results,
+		site:       declSite(),
 	}
 }
 
@@ -56,11 +80,120 @@ func (c *BaseMatcher) AddResult(results []interface{}) {
 	// TODO results check
 	result, err := arg.I2V(results, outTypes(c.funTyp))
 	if err != nil {
-		panic("Return Value (" + fmt.Sprintf("%v", results) + ") error: " + err.Error())
+		panic("Return Value (" + fmt.Sprintf("%v", results) + ") error: " + withMocker(err, c.name, "return").Error())
 	}
 	c.results = append(c.results, result)
 }
 
+// addOutArg 添加出参写入
+func (c *BaseMatcher) addOutArg(o *arg.OutArg) {
+	c.outArgs = append(c.outArgs, o)
+}
+
+// applyOutArgs 将出参写入参数指向的内存
+// args 调用参数(不含方法接收体)
+func (c *BaseMatcher) applyOutArgs(args []reflect.Value) error {
+	for _, o := range c.outArgs {
+		if err := o.Apply(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addInState 添加状态条件
+func (c *BaseMatcher) addInState(s *stateClause) {
+	c.inStates = append(c.inStates, s)
+}
+
+// addTransition 添加状态迁移
+func (c *BaseMatcher) addTransition(s *stateClause) {
+	c.transitions = append(c.transitions, s)
+}
+
+// enterState 满足所有状态条件时执行状态迁移
+func (c *BaseMatcher) enterState() bool {
+	return enterState(c.inStates, c.transitions)
+}
+
+// hasResult 是否已经指定了返回值
+func (c *BaseMatcher) hasResult() bool {
+	return len(c.results) > 0
+}
+
+// setDelay 设置返回前的延迟
+func (c *BaseMatcher) setDelay(d time.Duration) {
+	c.delay = d
+}
+
+// setPanic 设置匹配成功后抛出的 panic
+func (c *BaseMatcher) setPanic(v interface{}) {
+	c.panicValue = v
+}
+
+// applyEffects 执行延迟和 panic
+func (c *BaseMatcher) applyEffects() {
+	if c.delay > 0 {
+		// 不使用 time.Sleep, 避免 time.Sleep 被 mock 后延迟失效
+		<-time.After(c.delay)
+	}
+	if c.panicValue != nil {
+		panic(c.panicValue)
+	}
+}
+
+// addCaller 添加调用方条件
+func (c *BaseMatcher) addCaller(pattern *regexp.Regexp) {
+	c.callers = append(c.callers, pattern)
+}
+
+// matchCaller 判断调用栈是否满足调用方条件, 未指定调用方条件时总是满足
+func (c *BaseMatcher) matchCaller(frames []string) bool {
+	return len(c.callers) == 0 || matchFrames(c.callers, frames)
+}
+
+// hasCaller 是否指定了调用方条件
+func (c *BaseMatcher) hasCaller() bool {
+	return len(c.callers) != 0
+}
+
+// callerMatcher 支持调用方条件的匹配器
+type callerMatcher interface {
+	addCaller(pattern *regexp.Regexp)
+	matchCaller(frames []string) bool
+	hasCaller() bool
+}
+
+// hit 记录一次匹配成功
+func (c *BaseMatcher) hit() {
+	atomic.AddInt64(&c.hits, 1)
+}
+
+// usage 条件声明的代码位置和匹配成功的次数
+func (c *BaseMatcher) usage() (string, int64) {
+	return c.site, atomic.LoadInt64(&c.hits)
+}
+
+// usageMatcher 记录使用情况的匹配器
+type usageMatcher interface {
+	hit()
+	usage() (string, int64)
+}
+
+// effectMatcher 支持延迟和 panic 注入的匹配器
+type effectMatcher interface {
+	hasResult() bool
+	setDelay(d time.Duration)
+	setPanic(v interface{})
+	applyEffects()
+}
+
+// outArgMatcher 支持出参写入的匹配器
+type outArgMatcher interface {
+	addOutArg(o *arg.OutArg)
+	applyOutArgs(args []reflect.Value) error
+}
+
 // EmptyMatch 没有返回参数的匹配器
 type EmptyMatch struct {
 	*AlwaysMatcher
@@ -68,7 +201,9 @@ type EmptyMatch struct {
 
 // newEmptyMatch 创建无参数匹配器
 func newEmptyMatch() *EmptyMatch {
-	return &EmptyMatch{}
+	return &EmptyMatch{
+		AlwaysMatcher: &AlwaysMatcher{BaseMatcher: newBaseMatcher("", nil, nil)},
+	}
 }
 
 // Result 返回参数
@@ -89,14 +224,15 @@ type DefaultMatcher struct {
 }
 
 // newDefaultMatch 创建新参数匹配
-func newDefaultMatch(args []interface{}, results []interface{}, isMethod bool, funTyp reflect.Type) *DefaultMatcher {
+func newDefaultMatch(name string, args []interface{}, results []interface{}, isMethod bool,
+	funTyp reflect.Type) *DefaultMatcher {
 	e, err := arg.ToExpr(args, inTypes(isMethod, funTyp))
 	if err != nil {
-		panic(fmt.Sprintf("Call When("+fmt.Sprintf("%v", args)+") error: %v", err))
+		panic(fmt.Sprintf("Call When("+fmt.Sprintf("%v", args)+") error: %v", withMocker(err, name, "arg")))
 	}
 	return &DefaultMatcher{
 		exprs:       e,
-		BaseMatcher: newBaseMatcher(results, funTyp),
+		BaseMatcher: newBaseMatcher(name, results, funTyp),
 		isMethod:    isMethod,
 	}
 }
@@ -133,17 +269,17 @@ type ContainsMatcher struct {
 }
 
 // newContainsMatch 创建新的包含类型的参数匹配
-func newContainsMatch(args []interface{}, results []interface{}, isMethod bool,
+func newContainsMatch(name string, args []interface{}, results []interface{}, isMethod bool,
 	funTyp reflect.Type) *ContainsMatcher {
 	in := arg.In(args...)
 	err := in.Resolve(inTypes(isMethod, funTyp))
 	if err != nil {
 		// TODO add mocker and method name to message
-		panic(fmt.Sprintf("create param match fail: %v", err))
+		panic(fmt.Sprintf("create param match fail: %v", withMocker(err, name, "arg")))
 	}
 	return &ContainsMatcher{
 		expr:        in,
-		BaseMatcher: newBaseMatcher(results, funTyp),
+		BaseMatcher: newBaseMatcher(name, results, funTyp),
 		isMethod:    isMethod,
 	}
 }
@@ -167,12 +303,12 @@ type AlwaysMatcher struct {
 }
 
 // newAlwaysMatch 创建新的默认匹配
-func newAlwaysMatch(results []interface{}, funTyp reflect.Type) *AlwaysMatcher {
+func newAlwaysMatch(name string, results []interface{}, funTyp reflect.Type) *AlwaysMatcher {
 	if results == nil {
 		return nil
 	}
 	return &AlwaysMatcher{
-		BaseMatcher: newBaseMatcher(results, funTyp),
+		BaseMatcher: newBaseMatcher(name, results, funTyp),
 	}
 }
 
@@ -180,3 +316,11 @@ func newAlwaysMatch(results []interface{}, funTyp reflect.Type) *AlwaysMatcher {
 func (c *AlwaysMatcher) Match(_ []reflect.Value) bool {
 	return true
 }
+
+// withMocker 给类型不匹配异常添加 mocker 名称和类型(arg 或 return)
+func withMocker(err error, name string, kind string) error {
+	if e, ok := err.(*erro.ValueNotMatch); ok {
+		return e.Of(name, kind)
+	}
+	return err
+}
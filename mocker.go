@@ -31,6 +31,17 @@ type Mocker interface {
 	String() string
 }
 
+// Suspender 支持暂停和恢复的 mocker, 内置的 mocker 都实现了该接口
+// 单独定义而不加入 Mocker, 不影响外部已有的 Mocker 实现
+type Suspender interface {
+	// Suspend 暂停代理, 调用执行原函数, 保留 When、Return 等设置
+	Suspend()
+	// Resume 恢复暂停的代理
+	Resume()
+	// Suspended 是否已经被暂停
+	Suspended() bool
+}
+
 // ExportedMocker 导出函数 mock 接口
 type ExportedMocker interface {
 	Mocker
@@ -44,6 +55,28 @@ type ExportedMocker interface {
 	Origin(originFunc interface{}) ExportedMocker
 }
 
+// FuncMocker 函数和方法 mock 接口, 在 ExportedMocker 的基础上支持暂停、调用记录、Spy、录制回放和拦截层
+// Func 和 Struct(...).Method 返回的 mocker 实现了该接口, As 返回的 ExportedMocker 可以通过类型断言转换
+type FuncMocker interface {
+	ExportedMocker
+	Suspender
+	// Recorder 调用记录查询
+	Recorder
+	// ReturnZero 返回值全部使用零值
+	ReturnZero() *When
+	// Spy 只记录调用, 仍然执行原函数
+	Spy() FuncMocker
+	// Record 录制或回放调用, path 为 golden 文件路径
+	// golden 文件不存在或者环境变量 GOOM_RECORD=1 时执行原函数并录制, 否则按照文件中的参数和返回值回放
+	Record(path string) FuncMocker
+	// Before 添加在调用之前执行的拦截层, 同一个函数上可以叠加多个拦截层
+	Before(fn func(args []interface{})) *Layer
+	// After 添加在调用返回之后执行的拦截层
+	After(fn func(args, results []interface{})) *Layer
+	// Around 添加环绕调用的拦截层
+	Around(fn AroundFunc) *Layer
+}
+
 // UnExportedMocker 未导出函数 mock 接口
 type UnExportedMocker interface {
 	Mocker
@@ -65,51 +98,49 @@ type baseMocker struct {
 	when *When
 	// canceled 是否被取消
 	canceled bool
+	// builder 创建当前 mocker 的构建器
+	builder *Builder
+	// callRecorder 调用记录
+	*callRecorder
+	// recordPath 录制模式下 golden 文件的路径
+	recordPath string
+	// site mocker 声明的代码位置
+	site string
+	// layers 当前 mocker 添加的拦截层
+	layers []*Layer
+	// suspended 是否被暂停
+	suspended bool
+	// trampolines 自动生成的跳板函数的指令地址, 取消之后回收
+	trampolines []uintptr
+	// patched 最近一次应用 mock 的目标函数, 用于回滚批量应用时重新应用
+	patched patchTarget
 }
 
 // newBaseMocker 新增基础类型 mocker
 func newBaseMocker(pkgName string) *baseMocker {
 	return &baseMocker{
-		pkgName: pkgName,
+		pkgName:      pkgName,
+		callRecorder: newCallRecorder(),
+		site:         declSite(),
 	}
 }
 
-// applyByName 根据函数名称应用 mock
-func (m *baseMocker) applyByName(funcName string, callback interface{}) {
-	guard, err := proxy.FuncName(funcName, callback, m.origin)
-	if err != nil {
-		panic(fmt.Sprintf("proxy func name error: %v", err))
+// bind 绑定创建当前 mocker 的构建器
+func (m *baseMocker) bind(b *Builder) {
+	m.builder = b
+	if b != nil {
+		m.callRecorder.log = b.callLog
 	}
-
-	m.guard = newPatchMockGuard(guard)
-	m.guard.Apply()
-	m.imp = callback
 }
 
-// applyByFunc 根据函数应用 mock
-func (m *baseMocker) applyByFunc(funcDef interface{}, callback interface{}) {
-	guard, err := proxy.Func(funcDef, callback, m.origin)
-	if err != nil {
-		panic(fmt.Sprintf("proxy func definition error: %v", err))
-	}
-
-	m.guard = newPatchMockGuard(guard)
-	m.guard.Apply()
-	m.imp = callback
-	m.funcDef = funcDef
+// allowPartialReturn 是否允许只指定部分返回值, 未指定的返回值使用零值
+func (m *baseMocker) allowPartialReturn() bool {
+	return m.builder != nil && m.builder.partialReturn
 }
 
-// applyByMethod 根据函数名应用 mock
-func (m *baseMocker) applyByMethod(structDef interface{}, method string, callback interface{}) {
-	guard, err := proxy.Method(reflect.TypeOf(structDef), method, callback, m.origin)
-	if err != nil {
-		panic(fmt.Sprintf("proxy method error: %v", err))
-	}
-
-	m.guard = newPatchMockGuard(guard)
-	m.guard.Apply()
-	m.imp = callback
-	m.funcDef = reflect.ValueOf(structDef).MethodByName(method).Interface()
+// applyByName 根据函数名称应用 mock
+func (m *baseMocker) applyByName(funcName string, callback interface{}) {
+	m.applyPatch(nameTarget(funcName), callback)
 }
 
 // applyByIFaceMethod 根据接口方法应用 mock
@@ -126,11 +157,26 @@ func (m *baseMocker) applyByIFaceMethod(ctx *iface.IContext, iFace interface{},
 		panic(erro.NewTraceableErrorc("interface mock apply error", err))
 	}
 
-	m.guard = newIFaceMockGuard(ctx)
+	m.guard = newIFaceMockGuard(ctx, m)
 	m.guard.Apply()
 	m.imp = callback
 }
 
+// spy 生成调用原函数的代理函数, 原函数通过自动生成的跳板函数调用
+func (m *baseMocker) spy(funcTyp reflect.Type) iface.PFunc {
+	origin, err := m.autoTrampoline(funcTyp)
+	if err != nil {
+		panic(fmt.Sprintf("spy trampoline error: %v", err))
+	}
+	m.origin = origin
+	m.when = nil
+	m.keepAll()
+	originV := reflect.ValueOf(origin).Elem()
+	return func(args []reflect.Value) []reflect.Value {
+		return callValue(originV, args)
+	}
+}
+
 // whens 指定的返回值
 func (m *baseMocker) whens(when *When) error {
 	m.imp = reflect.MakeFunc(when.funcTyp, m.callback).Interface()
@@ -154,9 +200,13 @@ func (m *baseMocker) callback(args []reflect.Value) (results []reflect.Value) {
 
 // Cancel 取消 Mock
 func (m *baseMocker) Cancel() {
+	m.cancelRecord()
 	if m.guard != nil {
 		m.guard.Cancel()
 	}
+	m.cancelLayers()
+	m.releaseTrampolines()
+	m.closeCalls()
 	m.when = nil
 	m.origin = nil
 	m.canceled = true
@@ -196,7 +246,7 @@ func (m *MethodMocker) String() string {
 }
 
 // Method 设置结构体的方法名
-func (m *MethodMocker) Method(name string) ExportedMocker {
+func (m *MethodMocker) Method(name string) FuncMocker {
 	if name == "" {
 		panic("method is empty")
 	}
@@ -237,18 +287,28 @@ func (m *MethodMocker) ExportMethod(name string) UnExportedMocker {
 // mock 回调函数, 需要和 mock 模板函数的签名保持一致
 // 方法的参数签名写法比如: func(s *Struct, arg1, arg2 type), 其中第一个参数必须是接收体类型
 func (m *MethodMocker) Apply(callback interface{}) {
-	m.doApply(callback)
+	m.doApply(callback, nil)
 }
 
-func (m *MethodMocker) doApply(imp interface{}) {
+// doApply 应用 mock
+// pFunc 不为 nil 时, 使用 pFunc 作为 imp 的实现
+func (m *MethodMocker) doApply(imp interface{}, pFunc iface.PFunc) {
 	if m.method == "" {
 		panic("method is empty")
 	}
-	imp, _ = interceptDebugInfo(imp, nil, m)
-	m.applyByMethod(m.structDef, m.method, imp)
+	imp, _ = interceptCalls(imp, pFunc, m, m.callRecorder, true)
+	m.applyPatch(m.target(), imp)
 	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(6), m.String())
 }
 
+// target 被 patch 的目标方法
+func (m *MethodMocker) target() patchTarget {
+	if m.method == "" {
+		panic("method is empty")
+	}
+	return methodTarget(m.structDef, m.method)
+}
+
 // When 指定条件匹配
 func (m *MethodMocker) When(specArg ...interface{}) *When {
 	if m.method == "" {
@@ -275,7 +335,7 @@ func (m *MethodMocker) When(specArg ...interface{}) *When {
 		panic(err)
 	}
 
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
@@ -298,10 +358,18 @@ func (m *MethodMocker) Return(value ...interface{}) *When {
 	if err := m.whens(when); err != nil {
 		panic(err)
 	}
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
+// ReturnZero 返回值全部使用零值
+func (m *MethodMocker) ReturnZero() *When {
+	if m.method == "" {
+		panic("method is empty")
+	}
+	return m.Return(zeroResults(reflect.TypeOf(m.methodIns))...)
+}
+
 // Returns 依次按顺序返回值
 func (m *MethodMocker) Returns(values ...interface{}) *When {
 	if m.method == "" {
@@ -322,10 +390,31 @@ func (m *MethodMocker) Returns(values ...interface{}) *When {
 		panic(err)
 	}
 	m.when.Returns(values...)
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
+// Spy 只记录调用, 仍然执行原方法
+// 调用记录可以通过 Invocations、Times、CalledWith 查询
+func (m *MethodMocker) Spy() FuncMocker {
+	if m.method == "" {
+		panic("method is empty")
+	}
+	funcTyp := reflect.TypeOf(m.methodIns)
+	// imp 仅用于指定函数类型, 实际调用 pFunc
+	m.doApply(reflect.Zero(funcTyp).Interface(), m.spy(funcTyp))
+	return m
+}
+
+// Record 录制或回放方法调用
+func (m *MethodMocker) Record(path string) FuncMocker {
+	if m.method == "" {
+		panic("method is empty")
+	}
+	m.record(path, reflect.TypeOf(m.methodIns), true, m.Spy, func() *When { return m.Returns() })
+	return m
+}
+
 // Origin 指定调用的原函数
 func (m *MethodMocker) Origin(originFunc interface{}) ExportedMocker {
 	m.origin = originFunc
@@ -379,7 +468,7 @@ func (m *UnexportedMethodMocker) Apply(callback interface{}) {
 		_, _ = unexports2.FindFuncByName(name)
 	}
 
-	callback, _ = interceptDebugInfo(callback, nil, m)
+	callback, _ = interceptCalls(callback, nil, m, m.callRecorder, true)
 	m.applyByName(name, callback)
 	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(5), m.String())
 }
@@ -443,7 +532,7 @@ func (m *UnexportedFuncMocker) objName() string {
 // mock 回调函数, 需要和 mock 模板函数的签名保持一致
 // 方法的参数签名写法比如: func(s *Struct, arg1, arg2 type), 其中第一个参数必须是接收体类型
 func (m *UnexportedFuncMocker) Apply(callback interface{}) {
-	callback, _ = interceptDebugInfo(callback, nil, m)
+	callback, _ = interceptCalls(callback, nil, m, m.callRecorder, false)
 	m.applyByName(m.objName(), callback)
 	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(5), m.String())
 }
@@ -491,26 +580,33 @@ func NewDefMocker(pkgName string, funcDef interface{}) *DefMocker {
 
 // Apply 代理方法实现
 func (m *DefMocker) Apply(callback interface{}) {
-	m.doApply(callback)
+	m.doApply(callback, nil)
 }
 
-func (m *DefMocker) doApply(imp interface{}) {
+// doApply 应用 mock
+// pFunc 不为 nil 时, 使用 pFunc 作为 imp 的实现
+func (m *DefMocker) doApply(imp interface{}, pFunc iface.PFunc) {
 	if m.funcDef == nil {
 		panic("funcDef is empty")
 	}
 
+	imp, _ = interceptCalls(imp, pFunc, m, m.callRecorder, false)
+	m.applyPatch(m.target(), imp)
+	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(6), m.String())
+}
+
+// target 被 patch 的目标函数
+func (m *DefMocker) target() patchTarget {
 	funcName := functionName(m.funcDef)
-	imp, _ = interceptDebugInfo(imp, nil, m)
 	if patch.IsGenericsFunc(funcName) {
 		// for generic variants func
-		m.applyByFunc(m.funcDef, imp)
-	} else if strings.HasSuffix(funcName, "-fm") {
+		return funcTarget(m.funcDef)
+	}
+	if strings.HasSuffix(funcName, "-fm") {
 		// TODO 理清-fm的用意
-		m.applyByName(strings.TrimSuffix(funcName, "-fm"), imp)
-	} else {
-		m.applyByFunc(m.funcDef, imp)
+		return nameTarget(strings.TrimSuffix(funcName, "-fm"))
 	}
-	logger.Consolefc(logger.DebugLevel, "mocker [%s] apply.", logger.Caller(6), m.String())
+	return funcTarget(m.funcDef)
 }
 
 // When 指定条件匹配
@@ -528,7 +624,7 @@ func (m *DefMocker) When(specArg ...interface{}) *When {
 	if err := m.whens(when); err != nil {
 		panic(err)
 	}
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
@@ -547,10 +643,15 @@ func (m *DefMocker) Return(value ...interface{}) *When {
 	if err := m.whens(when); err != nil {
 		panic(err)
 	}
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
+// ReturnZero 返回值全部使用零值
+func (m *DefMocker) ReturnZero() *When {
+	return m.Return(zeroResults(reflect.TypeOf(m.funcDef))...)
+}
+
 // Returns 依次按顺序返回值, 如果是多参可使用[]interface{}
 func (m *DefMocker) Returns(values ...interface{}) *When {
 	if m.when != nil {
@@ -567,10 +668,31 @@ func (m *DefMocker) Returns(values ...interface{}) *When {
 		panic(err)
 	}
 	m.when.Returns(values...)
-	m.doApply(m.imp)
+	m.doApply(m.imp, m.callback)
 	return when
 }
 
+// Spy 只记录调用, 仍然执行原函数
+// 调用记录可以通过 Invocations、Times、CalledWith 查询
+func (m *DefMocker) Spy() FuncMocker {
+	if m.funcDef == nil {
+		panic("funcDef is empty")
+	}
+	funcTyp := reflect.TypeOf(m.funcDef)
+	// imp 仅用于指定函数类型, 实际调用 pFunc
+	m.doApply(reflect.Zero(funcTyp).Interface(), m.spy(funcTyp))
+	return m
+}
+
+// Record 录制或回放函数调用
+func (m *DefMocker) Record(path string) FuncMocker {
+	if m.funcDef == nil {
+		panic("funcDef is empty")
+	}
+	m.record(path, reflect.TypeOf(m.funcDef), false, m.Spy, func() *When { return m.Returns() })
+	return m
+}
+
 // Origin 调用原函数
 // origin 需要和原函数的参数列表保持一致
 func (m *DefMocker) Origin(originFunc interface{}) ExportedMocker {
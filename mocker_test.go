@@ -3,14 +3,27 @@
 package mocker_test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime/pprof"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/suite"
 	mocker "github.com/tencent/goom"
+	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/erro"
+	"github.com/tencent/goom/internal/bytecode/memory"
 	"github.com/tencent/goom/test"
 )
 
@@ -252,6 +265,16 @@ func (s *mockerTestSuite) TestUnitFuncTwiceApply() {
 		s.Equal(2, test.Foo(1), "foo mock reset check")
 		mock.Reset()
 	})
+	s.Run("apply same mocker twice", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Foo).Apply(func(int) int { return 100 })
+		mock.Func(test.Foo).Apply(func(int) int { return 200 })
+		s.Equal(200, test.Foo(1), "reapply check")
+
+		mock.Reset()
+		s.Equal(1, test.Foo(1), "reset after reapply check")
+	})
 }
 
 // TestUnitDefaultReturn 测试函数 mock 返回默认值
@@ -294,6 +317,312 @@ func (s *mockerTestSuite) TestUnitNilReturn() {
 	})
 }
 
+// TestUnitSetArg 测试出参写入
+func (s *mockerTestSuite) TestUnitSetArg() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.Func(test.Load).When("a", arg.Any()).SetArg(1, test.Config{Name: "mocked"}).Return(nil).
+			When("b", arg.Any()).SetArgField(1, "size", 10).Return(s.fakeErr)
+
+		c := &test.Config{}
+		s.Nil(test.Load("a", c), "load mock check")
+		s.Equal("mocked", c.Name, "set arg check")
+		s.Equal(s.fakeErr, test.Load("b", c), "load mock check")
+		s.Equal(10, c.Size(), "set arg field check")
+	})
+}
+
+// TestUnitReturnZero 测试返回零值和部分返回值
+func (s *mockerTestSuite) TestUnitReturnZero() {
+	s.Run("return zero", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.Func(test.Stat).ReturnZero()
+		size, mode, name, st, err := test.Stat("a")
+		s.Equal(int64(0), size)
+		s.Equal(uint32(0), mode)
+		s.Equal("", name)
+		s.Nil(st)
+		s.Nil(err)
+	})
+	s.Run("partial return", func() {
+		mock := mocker.Create().AllowPartialReturn()
+		defer mock.Reset()
+
+		mock.Func(test.Stat).When("a").Return(1, 2).When("b").Return(0, 0, "", nil, s.fakeErr)
+		size, mode, name, st, err := test.Stat("a")
+		s.Equal(int64(1), size, "convert int to int64 check")
+		s.Equal(uint32(2), mode, "convert int to uint32 check")
+		s.Equal("", name)
+		s.Nil(st)
+		s.Nil(err)
+
+		_, _, _, _, err = test.Stat("b")
+		s.Equal(s.fakeErr, err)
+	})
+	s.Run("partial return not allowed", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		s.Panics(func() {
+			mock.Func(test.Stat).Return(1)
+		})
+		s.Panics(func() {
+			mock.Func(test.Stat).ReturnZero().AndReturn(1, -1, "", nil, nil)
+		}, "negative value to uint32 check")
+	})
+	s.Run("convert float32", func() {
+		cases := []struct {
+			name     string
+			value    interface{}
+			want     float32
+			overflow bool
+		}{
+			{name: "float64 constant", value: 0.1, want: 0.1},
+			{name: "int constant", value: 3, want: 3},
+			{name: "max float32", value: float64(math.MaxFloat32), want: math.MaxFloat32},
+			{name: "float64 overflow", value: math.MaxFloat64, overflow: true},
+			{name: "negative overflow", value: -1e39, overflow: true},
+		}
+		for _, c := range cases {
+			mock := mocker.Create()
+			if c.overflow {
+				s.Panics(func() {
+					mock.Func(test.Ratio).Return(c.value)
+				}, c.name)
+			} else {
+				mock.Func(test.Ratio).Return(c.value)
+				s.Equal(c.want, test.Ratio(1), c.name)
+			}
+			mock.Reset()
+		}
+	})
+}
+
+// TestUnitState 测试多个 mocker 共享状态
+func (s *mockerTestSuite) TestUnitState() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		conn := mock.State("conn").Init("up")
+		mock.Func(test.Foo).When(1).InState(conn, "up").Return(10).
+			When(1).InState(conn, "down").Return(-1).Transition(conn, "up")
+
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").As(func(ctx *mocker.IContext, i int) int {
+			return 0
+		}).When(0).Return(0).InState(conn, "up").Transition(conn, "down")
+
+		s.Equal(10, test.Foo(1), "state up check")
+		s.Equal(0, i.Call(0), "interface transition check")
+		s.Equal("down", conn.Current(), "state transition check")
+		s.Equal(-1, test.Foo(1), "state down check")
+		s.Equal(10, test.Foo(1), "state reconnected check")
+		s.Same(conn, mock.State("conn"), "state shared check")
+
+		conn.Set("down")
+		mock.Reset()
+		s.Equal("up", conn.Current(), "state reset check")
+	})
+	s.Run("by name", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.State("conn").Init("up")
+		mock.Func(test.Foo).When(1).InState("up").Return(10).
+			When(1).InState("down").Return(-1).Transition("up")
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").As(func(ctx *mocker.IContext, i int) int {
+			return 0
+		}).When(0).Return(0).InState("conn", "up").Transition("conn", "down")
+
+		s.Equal(10, test.Foo(1), "state up check")
+		s.Equal(0, i.Call(0), "interface transition check")
+		s.Equal(-1, test.Foo(1), "state down check")
+		s.Equal(10, test.Foo(1), "state reconnected check")
+
+		mock.State("other")
+		s.Panics(func() {
+			mock.Func(test.Foo1).Return(nil).InState("up")
+		}, "ambiguous state check")
+	})
+	s.Run("atomic transition", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.State("conn").Init("up")
+		mock.Func(test.Foo).When(1).InState("up").Return(10).Transition("down").
+			When(1).Return(-1)
+
+		const n = 50
+		results := make(chan int, n)
+		start := make(chan struct{})
+		for j := 0; j < n; j++ {
+			go func() {
+				<-start
+				results <- test.Foo(1)
+			}()
+		}
+		close(start)
+		matched := 0
+		for j := 0; j < n; j++ {
+			if <-results == 10 {
+				matched++
+			}
+		}
+		s.Equal(1, matched, "only one call matches state up check")
+	})
+}
+
+// TestUnitSpy 测试 Spy 模式和调用记录
+func (s *mockerTestSuite) TestUnitSpy() {
+	s.Run("func spy", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		spy := mock.Func(test.Foo).Spy()
+		s.Equal(1, test.Foo(1), "spy call origin check")
+		s.Equal(2, test.Foo(2), "spy call origin check")
+
+		s.Equal(2, spy.Times(), "spy times check")
+		s.True(spy.CalledWith(1), "spy called with check")
+		s.True(spy.CalledWith(arg.In(2, 3)), "spy called with expr check")
+		s.False(spy.CalledWith(3), "spy not called with check")
+
+		call := spy.Invocations()[0]
+		s.Equal([]interface{}{1}, call.Args, "spy args check")
+		s.Equal([]interface{}{1}, call.Results, "spy results check")
+		s.NotZero(call.Goroutine, "spy goroutine check")
+		s.False(call.Time.IsZero(), "spy time check")
+	})
+	s.Run("method spy", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		f := &test.Fake{}
+		spy := mock.Struct(f).Method("Call").Spy()
+		s.Equal(1, f.Call(1), "method spy call origin check")
+		s.Equal(1, spy.Times(), "method spy times check")
+		s.Same(f, spy.Invocations()[0].Receiver, "method spy receiver check")
+	})
+	s.Run("mock records", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mf := mock.Func(test.Foo)
+		mf.When(1).Return(3)
+		s.Equal(3, test.Foo(1), "mock return check")
+		s.Equal(1, mf.Times(), "mock times check")
+		s.True(mf.CalledWith(1), "mock called with check")
+	})
+	s.Run("bounded records", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mf := mock.Func(test.Foo)
+		mf.Return(3)
+		spy := mock.Func(test.Foo1).Spy()
+		for i := 0; i < 300; i++ {
+			test.Foo(i)
+			test.Foo1()
+		}
+		s.Equal(300, mf.Times(), "bounded times check")
+		s.Len(mf.Invocations(), 256, "bounded records check")
+		s.Equal([]interface{}{299}, mf.Invocations()[255].Args, "bounded latest record check")
+		s.False(mf.CalledWith(0), "bounded dropped record check")
+		s.Len(spy.Invocations(), 300, "spy keep all records check")
+	})
+}
+
+// TestUnitRecord 测试录制和回放
+func (s *mockerTestSuite) TestUnitRecord() {
+	s.Run("record and replay", func() {
+		golden := filepath.Join(s.T().TempDir(), "testdata", "fetch.golden.json")
+
+		mock := mocker.Create()
+		mock.Func(test.Fetch).Record(golden)
+		data, _, err := test.Fetch("a")
+		s.Equal("value:a", string(data), "record call origin check")
+		s.Nil(err, "record call origin check")
+		_, _, err = test.Fetch("")
+		s.Equal("empty key", err.Error(), "record call origin check")
+		mock.Reset()
+
+		content, err := os.ReadFile(golden)
+		s.Nil(err, "golden file check")
+		s.Contains(string(content), "$bytes", "bytes hint check")
+		s.Contains(string(content), "$time", "time hint check")
+		s.Contains(string(content), "$error", "error hint check")
+
+		replayed := strings.Replace(string(content), "empty key", "replayed", 1)
+		s.Nil(os.WriteFile(golden, []byte(replayed), 0644), "golden file update")
+
+		mock = mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Fetch).Record(golden)
+		data, tm, err := test.Fetch("a")
+		s.Equal("value:a", string(data), "replay bytes check")
+		s.Equal(2022, tm.Year(), "replay time check")
+		s.Nil(err, "replay nil error check")
+		_, _, err = test.Fetch("")
+		s.Equal("replayed", err.Error(), "replay error check")
+	})
+	s.Run("replay interface and error args", func() {
+		golden := filepath.Join(s.T().TempDir(), "publish.golden.json")
+
+		mock := mocker.Create()
+		mock.Func(test.Publish).Record(golden)
+		_, err := test.Publish(context.Background(), errors.New("timeout"), "a")
+		s.Equal("publish a: timeout", err.Error(), "record call origin check")
+		mock.Reset()
+
+		mock = mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Publish).Record(golden)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err = test.Publish(ctx, errors.New("timeout"), "a")
+		s.Equal("publish a: timeout", err.Error(), "replay error arg by message check")
+		s.PanicsWithValue("no call recorded in "+golden+" matches args [context.Background.WithCancel,nil,b], "+
+			"record again with GOOM_RECORD=1", func() {
+			_, _ = test.Publish(ctx, nil, "b")
+		}, "replay not recorded check")
+	})
+	s.Run("replay same args in order", func() {
+		golden := filepath.Join(s.T().TempDir(), "attempt.golden.json")
+		key := fmt.Sprintf("%s-%d", s.T().Name(), time.Now().UnixNano())
+
+		mock := mocker.Create()
+		mock.Func(test.Attempt).Record(golden)
+		_, err := test.Attempt(key)
+		s.Equal(503, err.Code, "record call origin check")
+		n, err := test.Attempt(key)
+		s.Equal(2, n, "record call origin check")
+		s.Nil(err, "record call origin check")
+		mock.Reset()
+
+		content, err2 := os.ReadFile(golden)
+		s.Nil(err2, "golden file check")
+		s.NotContains(string(content), "$error", "concrete error type without hint check")
+
+		mock = mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Attempt).Record(golden)
+		n, err = test.Attempt(key)
+		s.Equal(0, n, "replay first result check")
+		s.Equal(&test.RetryErr{Code: 503}, err, "replay concrete error check")
+		n, err = test.Attempt(key)
+		s.Equal(2, n, "replay second result check")
+		s.Nil(err, "replay second result check")
+		n, _ = test.Attempt(key)
+		s.Equal(2, n, "replay last result repeated check")
+	})
+}
+
 // TestVarMock 测试简单变量 mock
 func (s *mockerTestSuite) TestVarMock() {
 	s.Run("simple var mock", func() {
@@ -333,4 +662,1062 @@ func (s *mockerTestSuite) TestUnitSystemFuncApply() {
 		s.Equal(int32(3), rand.Int31(), "foo mock check")
 		s.Equal(date, time.Now(), "foo mock check")
 	})
+	s.Run("mock funcs used by recorder", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		since := mock.Func(time.Since)
+		since.Return(time.Second)
+		parse := mock.Func(strconv.ParseInt).Spy()
+
+		s.Equal(time.Second, time.Since(time.Time{}), "time.Since mock check")
+		s.Equal(1, since.Times(), "time.Since times check")
+		n, err := strconv.ParseInt("12", 10, 64)
+		s.Nil(err)
+		s.Equal(int64(12), n, "strconv.ParseInt spy check")
+		s.True(parse.CalledWith("12", 10, 64), "strconv.ParseInt called with check")
+	})
+}
+
+// TestUnitLoadFile 测试从文件加载 mock 定义
+func (s *mockerTestSuite) TestUnitLoadFile() {
+	defs := []interface{}{
+		test.Foo, test.Stat, (*test.Fake).Call,
+		mocker.Target{Name: "github.com/tencent/goom/test.foo", Func: func(int) int { return 0 }},
+	}
+	s.Run("yaml", func() {
+		path := filepath.Join(s.T().TempDir(), "mocks.yaml")
+		s.Nil(os.WriteFile(path, []byte(`
+- target: github.com/tencent/goom/test.Foo
+  when: [1]
+  return: [3]
+- target: github.com/tencent/goom/test.Foo
+  when: 2
+  returns: [[4], 5]
+- target: github.com/tencent/goom/test.Foo
+  when: [-1]
+  panic: boom
+- target: github.com/tencent/goom/test.Stat
+  return: [1, 2, "x", {field1: "f"}, "not found"]
+  delay: 10ms
+- target: github.com/tencent/goom/test.(*Fake).Call
+  when: [$any, 1]
+  return: 6
+- target: github.com/tencent/goom/test.foo
+  return: 7
+`), 0644))
+
+		mock := mocker.Create()
+		defer mock.Reset()
+		s.Nil(mocker.LoadFile(mock, path, defs...), "load file check")
+
+		s.Equal(3, test.Foo(1), "when return check")
+		s.Equal(4, test.Foo(2), "returns check")
+		s.Equal(5, test.Foo(2), "returns check")
+		s.PanicsWithValue("boom", func() { test.Foo(-1) }, "panic check")
+
+		start := time.Now()
+		n, u, name, st, err := test.Stat("a")
+		s.True(time.Since(start) >= 10*time.Millisecond, "delay check")
+		s.Equal(int64(1), n, "stat return check")
+		s.Equal(uint32(2), u, "stat return check")
+		s.Equal("x", name, "stat return check")
+		s.Equal("f", st.Field1, "stat struct return check")
+		s.Equal("not found", err.Error(), "stat error return check")
+
+		s.Equal(6, (&test.Fake{}).Call(1), "method return check")
+		s.Equal(7, test.Invokefoo(1), "unexported func return check")
+	})
+	s.Run("json", func() {
+		path := filepath.Join(s.T().TempDir(), "mocks.json")
+		s.Nil(os.WriteFile(path, []byte(`[
+  {"target": "github.com/tencent/goom/test.Foo", "when": [1], "return": [3]}
+]`), 0644))
+
+		mock := mocker.Create()
+		defer mock.Reset()
+		s.Nil(mocker.LoadFile(mock, path, defs...), "load file check")
+		s.Equal(3, test.Foo(1), "when return check")
+	})
+	s.Run("bare symbol names", func() {
+		path := filepath.Join(s.T().TempDir(), "mocks.yaml")
+		s.Nil(os.WriteFile(path, []byte(`
+- target: test.Foo
+  return: 3
+- target: (*Fake).Call
+  return: 6
+- target: test.foo
+  return: 7
+`), 0644))
+
+		mock := mocker.Create()
+		defer mock.Reset()
+		s.Nil(mocker.LoadFile(mock, path, test.Foo, (*test.Fake).Call,
+			mocker.Target{Name: "test.foo", Func: func(int) int { return 0 }}), "load file check")
+		s.Equal(3, test.Foo(1), "bare func name check")
+		s.Equal(6, (&test.Fake{}).Call(1), "bare method name check")
+		s.Equal(7, test.Invokefoo(1), "bare target name check")
+	})
+	s.Run("keep package", func() {
+		path := filepath.Join(s.T().TempDir(), "mocks.yaml")
+		s.Nil(os.WriteFile(path, []byte(`
+- target: test.Foo
+  return: 3
+`), 0644))
+
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Pkg("github.com/tencent/goom/test")
+		s.Nil(mocker.LoadFile(mock, path, test.Foo), "load file check")
+		s.Equal("github.com/tencent/goom/test", mock.PkgName(), "package kept check")
+		mock.ExportFunc("foo").As(func(i int) int {
+			return 0
+		}).Return(8)
+		s.Equal(3, test.Foo(1), "loaded mock check")
+		s.Equal(8, test.Invokefoo(1), "export func after load check")
+	})
+	s.Run("errors", func() {
+		path := filepath.Join(s.T().TempDir(), "mocks.yaml")
+		s.Nil(os.WriteFile(path, []byte(`- target: github.com/tencent/goom/test.Foo
+  return: [1]
+- target: github.com/tencent/goom/test.NotExists
+  return: [1]
+`), 0644))
+		mock := mocker.Create()
+		defer mock.Reset()
+		err := mocker.LoadFile(mock, path, defs...)
+		s.Contains(err.Error(), path+":3: target [github.com/tencent/goom/test.NotExists]: unknown symbol",
+			"unknown symbol check")
+
+		path = filepath.Join(s.T().TempDir(), "mocks.json")
+		s.Nil(os.WriteFile(path, []byte(`[
+  {"target": "github.com/tencent/goom/test.Foo", "return": [1]},
+  {"target": "github.com/tencent/goom/test.Foo", "when": ["a"], "return": [1]}
+]`), 0644))
+		err = mocker.LoadFile(mock, path, defs...)
+		s.Contains(err.Error(), path+":3: target [github.com/tencent/goom/test.Foo]: when[0] int",
+			"type mismatch check")
+	})
+}
+
+// TestUnitAnchor 测试 mock 锚点
+func (s *mockerTestSuite) TestUnitAnchor() {
+	s.Run("success", func() {
+		s.Nil(test.Commit(1), "inactive anchor check")
+
+		mock := mocker.Create()
+		var got []interface{}
+		anchor := mock.Anchor("payment.beforeCommit")
+		anchor.Apply(func(args ...interface{}) {
+			got = args
+		})
+		s.Nil(test.Commit(2), "apply anchor check")
+		s.Equal([]interface{}{2}, got, "anchor args check")
+
+		mock.Anchor("payment.beforeCommit").Panic("db down")
+		s.Equal("commit 3: db down", test.Commit(3).Error(), "panic anchor check")
+		s.Equal(2, anchor.Times(), "anchor times check")
+		s.True(anchor.CalledWith(3), "anchor called with check")
+
+		mock.Reset()
+		s.Nil(test.Commit(4), "reset anchor check")
+		s.Equal(2, anchor.Times(), "reset anchor times check")
+	})
+	s.Run("cancel", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		other := mocker.Create()
+		defer other.Reset()
+
+		old := mock.Anchor("payment.beforeCommit")
+		old.Panic("old")
+		other.Anchor("payment.beforeCommit").Panic("new")
+		old.Cancel()
+		s.True(old.Canceled(), "cancel anchor check")
+		s.Equal("commit 5: new", test.Commit(5).Error(), "cancel keep newer anchor check")
+
+		other.Reset()
+		s.Nil(test.Commit(6), "reset newer anchor check")
+	})
+	s.Run("nested", func() {
+		outer := mocker.Create()
+		outer.Anchor("payment.beforeCommit").Panic("outer")
+		inner := mocker.Create()
+		inner.Anchor("payment.beforeCommit").Panic("inner")
+		s.Equal("commit 7: inner", test.Commit(7).Error(), "inner anchor check")
+
+		inner.Reset()
+		s.Equal("commit 8: outer", test.Commit(8).Error(), "restore outer anchor check")
+
+		inner = mocker.Create()
+		inner.Anchor("payment.beforeCommit").Panic("inner")
+		outer.Reset()
+		s.Equal("commit 9: inner", test.Commit(9).Error(), "overlapping reset keep inner anchor check")
+		inner.Reset()
+		s.Nil(test.Commit(10), "reset all anchors check")
+	})
+}
+
+// fakeT 记录校验失败的信息
+type fakeT struct {
+	msg      string
+	cleanups []func()
+}
+
+// Cleanup 注册单测结束时执行的函数
+func (t *fakeT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+// finish 按照注册的逆序执行 Cleanup
+func (t *fakeT) finish() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+	t.cleanups = nil
+}
+
+// Errorf 记录错误信息
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.msg = fmt.Sprintf(format, args...)
+}
+
+// TestUnitInOrder 测试跨 mocker 的调用顺序校验
+func (s *mockerTestSuite) TestUnitInOrder() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		lock := mock.Func(test.Foo)
+		lock.Return(0)
+		write := mock.Struct(&test.Fake{}).Method("Call")
+		write.Return(0)
+		i := (I)(nil)
+		unlock := mock.Interface(&i).Method("Call")
+		unlock.As(func(ctx *mocker.IContext, i int) int {
+			return 0
+		}).Return(0)
+
+		test.Foo(1)
+		(&test.Fake{}).Call(2)
+		test.Foo(3)
+		i.Call(4)
+
+		s.True(mocker.InOrder(lock, write, unlock).Verify(s.T()), "in order check")
+		s.True(mocker.InOrder(lock, mocker.Unordered(unlock, write)).Verify(s.T()), "partial order check")
+		s.True(mocker.InOrder(write, lock).Verify(s.T()), "interleaved order check")
+
+		t := &fakeT{}
+		s.False(mocker.InOrder(unlock, write).Verify(t), "out of order check")
+		seq := unlock.(mocker.RecordedMocker).Invocations()[0].Seq
+		s.Contains(t.msg, fmt.Sprintf("step[1] mocker [github.com/tencent/goom/test.(Fake).Call] "+
+			"not called after seq #%d", seq), "out of order message check")
+		s.Contains(t.msg, "observed sequence:", "observed sequence check")
+		s.Contains(t.msg, "args [4]", "observed args check")
+	})
+	s.Run("across builders", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		other := mocker.Create()
+		defer other.Reset()
+
+		first := mock.Func(test.Foo)
+		first.Return(0)
+		second := other.Struct(&test.Fake{}).Method("Call")
+		second.Return(0)
+		// 先在 first 所在的 builder 中产生调用, 按 builder 各自计数时 second 的序号会小于 first
+		mock.Func(test.Foo1).Return(nil)
+		test.Foo1()
+		test.Foo1()
+
+		test.Foo(1)
+		(&test.Fake{}).Call(2)
+		s.True(mocker.InOrder(first, second).Verify(s.T()), "across builders in order check")
+		s.False(mocker.InOrder(second, first).Verify(&fakeT{}), "across builders out of order check")
+	})
+}
+
+// TestUnitWaitCalled 测试等待后台协程中的调用
+func (s *mockerTestSuite) TestUnitWaitCalled() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mf := mock.Func(test.Foo)
+		mf.Return(0)
+		calls := mf.Calls()
+		go func() {
+			for i := 1; i <= 3; i++ {
+				test.Foo(i)
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Nil(mf.WaitCalled(ctx, 3), "wait called check")
+		s.Equal([]interface{}{1}, (<-calls).Args, "calls channel check")
+		s.Equal([]interface{}{2}, (<-calls).Args, "calls channel check")
+		s.True(mf.EventuallyCalledWith(s.T(), time.Second, 3), "eventually called with check")
+		s.True(mf.EventuallyCalled(s.T(), time.Second, 3), "eventually called check")
+		s.Equal([]interface{}{1}, (<-mf.Calls()).Args, "calls replay check")
+
+		t := &fakeT{}
+		s.False(mf.EventuallyCalled(t, 10*time.Millisecond, 4), "eventually timeout check")
+		s.Contains(t.msg, "wait called 4 times: context deadline exceeded, actual called 3 times",
+			"eventually timeout message check")
+	})
+	s.Run("close on reset", func() {
+		mock := mocker.Create()
+		mf := mock.Func(test.Foo)
+		mf.Return(0)
+		calls := mf.Calls()
+		test.Foo(1)
+		mock.Reset()
+
+		var args []interface{}
+		for c := range calls {
+			args = append(args, c.Args...)
+		}
+		s.Equal([]interface{}{1}, args, "closed calls channel check")
+		replay := mf.Calls()
+		_, ok := <-replay
+		s.True(ok, "calls replay after reset check")
+		_, ok = <-replay
+		s.False(ok, "calls closed after reset check")
+	})
+}
+
+// TestUnitTrace 测试导出调用日志
+func (s *mockerTestSuite) TestUnitTrace() {
+	s.Run("json lines", func() {
+		path := filepath.Join(s.T().TempDir(), "calls.jsonl")
+		mock := mocker.Create().TraceTo(path, mocker.TraceJSONLines)
+		mock.Func(test.Foo).Return(3)
+		test.Foo(1)
+		test.Foo(2)
+		mock.Reset()
+
+		content, err := os.ReadFile(path)
+		s.Nil(err, "trace file check")
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		s.Equal(2, len(lines), "trace lines check")
+
+		entry := map[string]interface{}{}
+		s.Nil(json.Unmarshal([]byte(lines[1]), &entry), "trace line check")
+		s.Equal("github.com/tencent/goom/test.Foo", entry["mocker"], "trace mocker check")
+		s.Equal("2", entry["args"], "trace args check")
+		s.Equal("3", entry["results"], "trace results check")
+		s.Contains(entry["caller"], "mocker_test.go:", "trace caller check")
+		s.NotZero(entry["goroutine"], "trace goroutine check")
+	})
+	s.Run("chrome", func() {
+		path := filepath.Join(s.T().TempDir(), "calls.json")
+		mock := mocker.Create().TraceTo(path, mocker.TraceChrome)
+		mock.Func(test.Foo).Return(3)
+		test.Foo(1)
+		mock.Reset()
+
+		content, err := os.ReadFile(path)
+		s.Nil(err, "trace file check")
+		trace := struct {
+			TraceEvents []map[string]interface{} `json:"traceEvents"`
+		}{}
+		s.Nil(json.Unmarshal(content, &trace), "chrome trace check")
+		s.Equal(1, len(trace.TraceEvents), "chrome events check")
+		s.Equal("X", trace.TraceEvents[0]["ph"], "chrome event phase check")
+		s.Equal("github.com/tencent/goom/test.Foo", trace.TraceEvents[0]["name"], "chrome event name check")
+	})
+	s.Run("not traced", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		mf := mock.Func(test.Foo)
+		mf.Return(3)
+		test.Foo(1)
+		s.Zero(mf.Invocations()[0].Goroutine, "not traced goroutine check")
+		s.Empty(mf.Invocations()[0].Caller, "not traced caller check")
+
+		mock.TraceTo(filepath.Join(s.T().TempDir(), "calls.jsonl"), mocker.TraceJSONLines)
+		test.Foo(2)
+		s.NotZero(mf.Invocations()[1].Goroutine, "traced goroutine check")
+	})
+}
+
+// TestUnitUsage 测试 mock 使用情况统计
+func (s *mockerTestSuite) TestUnitUsage() {
+	s.Run("success", func() {
+		file := filepath.Join(s.T().TempDir(), "goom-usage.json")
+		s.Nil(os.Setenv(mocker.UsageEnv, file), "set usage env")
+		defer os.Unsetenv(mocker.UsageEnv)
+
+		for i := 0; i < 2; i++ {
+			mock := mocker.Create().ReportUnused()
+			mock.Func(test.Foo).When(1).Return(3).When(2).Return(4)
+			mock.Func(test.Foo1).Return(nil)
+			test.Foo(1)
+
+			usages := mock.Usages()
+			unused := make([]string, 0)
+			for _, u := range usages {
+				if u.Hits == 0 {
+					unused = append(unused, u.Mocker+" "+u.Clause)
+				}
+			}
+			s.Equal([]string{
+				"github.com/tencent/goom/test.Foo when[1]",
+				"github.com/tencent/goom/test.Foo1 ",
+				"github.com/tencent/goom/test.Foo1 default",
+			}, unused, "unused check")
+			s.Contains(usages[0].Site, "mocker_test.go:", "site check")
+			mock.Reset()
+		}
+
+		content, err := os.ReadFile(file)
+		s.Nil(err, "usage file check")
+		var usages []*mocker.Usage
+		s.Nil(json.Unmarshal(content, &usages), "usage file format check")
+		s.Equal(5, len(usages), "usage file merge check")
+		for _, u := range usages {
+			if u.Mocker == "github.com/tencent/goom/test.Foo" && u.Clause == "when[0]" {
+				s.Equal(int64(2), u.Hits, "usage file hits check")
+			}
+		}
+	})
+}
+
+// TestUnitCalledFrom 测试按照调用方限定 mock 的生效范围
+func (s *mockerTestSuite) TestUnitCalledFrom() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mf := mock.Func(test.Foo)
+		mf.When(arg.Any()).Return(100).CalledFrom("github.com/tencent/goom/test.Invoke*").
+			When(5).Return(50)
+
+		s.Equal(100, test.InvokeFoo(1), "matched caller check")
+		s.Equal(2, test.Foo(2), "other caller call origin check")
+		s.Equal(50, test.Foo(5), "unscoped clause check")
+		s.Equal(3, mf.Times(), "called from times check")
+
+		mock.Reset()
+		s.Equal(1, test.InvokeFoo(1), "called from reset check")
+	})
+	s.Run("default return", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mf := mock.Func(test.Foo)
+		mf.Return(7).When(1).Return(100).CalledFrom("github.com/tencent/goom/test.Invoke*")
+		s.Equal(100, test.InvokeFoo(1), "matched caller check")
+		s.Equal(7, test.InvokeFoo(2), "matched caller default check")
+		s.Equal(2, test.Foo(2), "other caller skip default check")
+
+		mock.Reset()
+		mf = mock.Func(test.Foo)
+		mf.Return(7).CalledFrom("*").When(1).Return(100).CalledFrom("github.com/tencent/goom/test.Invoke*")
+		s.Equal(100, test.InvokeFoo(1), "explicit default matched caller check")
+		s.Equal(7, test.Foo(2), "explicit default other caller check")
+	})
+}
+
+// TestUnitScoped 测试按照协程树限定 mock 的生效范围
+func (s *mockerTestSuite) TestUnitScoped() {
+	s.Run("success", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		mock := mocker.Create().Scoped(ctx)
+		defer mock.Reset()
+
+		mock.Func(test.Foo).Return(100)
+		s.Equal(100, test.Foo(1), "scoped call check")
+
+		inherited := make(chan int)
+		go func() { inherited <- test.Foo(2) }()
+		s.Equal(100, <-inherited, "child goroutine check")
+
+		outside := make(chan int)
+		go func() {
+			pprof.SetGoroutineLabels(context.Background())
+			outside <- test.Foo(3)
+		}()
+		s.Equal(3, <-outside, "outside scope call origin check")
+
+		joined := make(chan int)
+		go func() {
+			pprof.SetGoroutineLabels(context.Background())
+			pprof.SetGoroutineLabels(mock.Context())
+			joined <- test.Foo(4)
+		}()
+		s.Equal(100, <-joined, "join scope check")
+
+		mock.Reset()
+		s.Equal(5, test.Foo(5), "scoped reset check")
+	})
+	s.Run("keep labels", func() {
+		pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("user", "a")))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		mock := mocker.Create().Scoped(ctx)
+		defer mock.Reset()
+		mock.Func(test.Foo).Return(100)
+
+		user, _ := pprof.Label(mock.Context(), "user")
+		s.Equal("a", user, "keep goroutine labels check")
+		pprof.Do(mock.Context(), pprof.Labels("req", "1"), func(context.Context) {
+			s.Equal(100, test.Foo(1), "pprof.Do in scope check")
+		})
+	})
+	s.Run("parallel", func() {
+		for i := 1; i <= 2; i++ {
+			ret := i * 100
+			s.T().Run(fmt.Sprintf("scope-%d", i), func(t *testing.T) {
+				t.Parallel()
+				mock := mocker.CreateT(t)
+				mock.Func(test.Foo).Return(ret)
+
+				for j := 0; j < 100; j++ {
+					if got := test.Foo(1); got != ret {
+						t.Fatalf("scope %s got %d, want %d", t.Name(), got, ret)
+					}
+				}
+			})
+		}
+	})
+}
+
+// TestUnitLayer 测试同一个函数上叠加拦截层
+func (s *mockerTestSuite) TestUnitLayer() {
+	s.Run("success", func() {
+		tracer := mocker.Create()
+		defer tracer.Reset()
+		injector := mocker.Create()
+		defer injector.Reset()
+
+		var order []string
+		tracer.Func(test.Foo).Before(func(args []interface{}) {
+			order = append(order, fmt.Sprintf("before %v", args))
+		})
+		around := injector.Func(test.Foo).Around(
+			func(args []interface{}, next func([]interface{}) []interface{}) []interface{} {
+				order = append(order, "around in")
+				results := next([]interface{}{args[0].(int) + 1})
+				order = append(order, "around out")
+				return results
+			})
+		tracer.Func(test.Foo).After(func(args, results []interface{}) {
+			order = append(order, fmt.Sprintf("after %v %v", args, results))
+		})
+
+		s.Equal(2, test.Foo(1), "around modify args check")
+		s.Equal([]string{"before [1]", "around in", "after [2] [2]", "around out"}, order, "layer order check")
+
+		injector.Func(test.Foo).Return(10)
+		s.Equal(10, test.Foo(1), "layer wrap mock check")
+
+		order = nil
+		around.Cancel()
+		s.True(around.Canceled(), "layer canceled check")
+		s.Equal(10, test.Foo(1), "cancel layer keep mock check")
+		s.Equal([]string{"before [1]", "after [1] [10]"}, order, "cancel layer order check")
+
+		tracer.Reset()
+		s.Equal(10, test.Foo(1), "reset layers keep mock check")
+		injector.Reset()
+		s.Equal(1, test.Foo(1), "reset all check")
+	})
+	s.Run("layer after mock", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		tracer := mocker.Create()
+		defer tracer.Reset()
+
+		mock.Func(test.Foo).Return(7)
+		var called []interface{}
+		tracer.Func(test.Foo).Before(func(args []interface{}) {
+			called = append(called, args[0])
+		})
+		s.Equal(7, test.Foo(1), "existing mock check")
+		s.Equal([]interface{}{1}, called, "layer on existing mock check")
+
+		tracer.Reset()
+		s.Equal(7, test.Foo(2), "cancel layer keep existing mock check")
+		mock.Reset()
+		s.Equal(3, test.Foo(3), "reset check")
+	})
+}
+
+// TestUnitNestedPatch 测试多个 builder mock 同一个函数时按照栈的方式恢复
+func (s *mockerTestSuite) TestUnitNestedPatch() {
+	s.Run("success", func() {
+		suiteMock := mocker.Create()
+		defer suiteMock.Reset()
+		suiteMock.Func(test.Foo).Return(1)
+
+		testMock := mocker.Create()
+		testMock.Func(test.Foo).Return(2)
+		s.Equal(2, test.Foo(0), "upper mock check")
+
+		testMock.Reset()
+		s.Equal(1, test.Foo(0), "restore lower mock check")
+
+		testMock.Func(test.Foo).Return(3)
+		suiteMock.Reset()
+		s.Equal(3, test.Foo(0), "cancel lower keep upper check")
+		testMock.Reset()
+		s.Equal(5, test.Foo(5), "restore origin check")
+	})
+	s.Run("shared patch", func() {
+		lower := mocker.Create()
+		defer lower.Reset()
+		tracer := mocker.Create()
+		defer tracer.Reset()
+		upper := mocker.Create()
+		defer upper.Reset()
+
+		lower.Func(test.Foo).Return(100)
+		var called int
+		tracer.Func(test.Foo).Before(func(args []interface{}) {
+			called++
+		})
+		upper.Func(test.Foo).Return(200)
+		s.Equal(200, test.Foo(0), "upper mock check")
+
+		upper.Reset()
+		s.Equal(100, test.Foo(0), "restore lower mock check")
+		tracer.Reset()
+		s.Equal(100, test.Foo(0), "cancel layer keep lower check")
+		s.Equal(2, called, "layer called check")
+		lower.Reset()
+		s.Equal(5, test.Foo(5), "restore origin check")
+	})
+	s.Run("migrate plain patches", func() {
+		lower := mocker.Create()
+		defer lower.Reset()
+		upper := mocker.Create()
+		defer upper.Reset()
+		tracer := mocker.Create()
+		defer tracer.Reset()
+
+		lower.Func(test.Foo).Return(100)
+		upper.Func(test.Foo).Return(200)
+		tracer.Func(test.Foo).Before(func(args []interface{}) {})
+		s.Equal(200, test.Foo(0), "upper mock check")
+
+		upper.Reset()
+		s.Equal(100, test.Foo(0), "restore lower mock check")
+		lower.Reset()
+		tracer.Reset()
+		s.Equal(5, test.Foo(5), "restore origin check")
+	})
+}
+
+// TestUnitLeak 测试 patch 泄漏检测
+func (s *mockerTestSuite) TestUnitLeak() {
+	s.Run("success", func() {
+		leak := mocker.Create()
+		defer leak.Reset()
+		ft := &fakeT{}
+		mocker.VerifyNoLeaksT(ft)
+		leak.Func(test.Foo).Return(2)
+
+		var found *mocker.ActivePatch
+		for _, p := range mocker.ActivePatches() {
+			if p.Func == "github.com/tencent/goom/test.Foo" {
+				found = p
+			}
+		}
+		s.NotNil(found, "active patch check")
+		s.Equal("github.com/tencent/goom/test.Foo", found.Mocker, "active patch mocker check")
+		s.Contains(found.Site, "mocker_test.go:", "active patch site check")
+
+		ft.finish()
+		s.Contains(ft.msg, "patches leaked after test", "leak report check")
+		s.Contains(ft.msg, "mocker [github.com/tencent/goom/test.Foo] declared at mocker_test.go:",
+			"leak report site check")
+
+		restored := &fakeT{}
+		mocker.VerifyNoLeaksT(restored, mocker.AutoRestore())
+		mocker.Create().Func(test.Foo).Return(3)
+		s.Equal(3, test.Foo(1), "upper leak check")
+		restored.finish()
+		s.Equal("", restored.msg, "auto restore check")
+		s.Equal(2, test.Foo(1), "auto restore to lower check")
+
+		leak.Reset()
+		s.Equal(1, test.Foo(1), "reset check")
+		for _, p := range mocker.ActivePatches() {
+			s.NotEqual("github.com/tencent/goom/test.Foo", p.Func, "no active patch check")
+		}
+	})
+}
+
+// TestUnitWaitInflight 测试取消 mock 时等待进行中的调用结束
+func (s *mockerTestSuite) TestUnitWaitInflight() {
+	s.Run("success", func() {
+		mock := mocker.Create().WaitInflight(time.Second)
+		entered, release := make(chan struct{}), make(chan struct{})
+		mock.Func(test.Foo).Apply(func(i int) int {
+			close(entered)
+			<-release
+			return 100
+		})
+
+		result := make(chan int)
+		go func() { result <- test.Foo(1) }()
+		<-entered
+
+		reset := make(chan struct{})
+		go func() {
+			mock.Reset()
+			close(reset)
+		}()
+		select {
+		case <-reset:
+			s.Fail("reset before in-flight call finished")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+		<-reset
+		s.Equal(100, <-result, "in-flight call result check")
+		s.Equal(1, test.Foo(1), "reset check")
+	})
+	s.Run("timeout", func() {
+		mock := mocker.Create().WaitInflight(20 * time.Millisecond)
+		entered, release := make(chan struct{}), make(chan struct{})
+		mock.Func(test.Foo).Apply(func(i int) int {
+			close(entered)
+			<-release
+			return 100
+		})
+
+		result := make(chan int)
+		go func() { result <- test.Foo(1) }()
+		<-entered
+		mock.Reset()
+		s.Equal(2, test.Foo(2), "reset after timeout check")
+		close(release)
+		s.Equal(100, <-result, "in-flight call result check")
+	})
+	s.Run("new calls while waiting", func() {
+		mock := mocker.Create().WaitInflight(10 * time.Second)
+		entered, release := make(chan struct{}, 1), make(chan struct{})
+		mock.Func(test.Foo).Apply(func(i int) int {
+			entered <- struct{}{}
+			<-release
+			return 100
+		})
+
+		go test.Foo(1)
+		<-entered
+		reset := make(chan struct{})
+		go func() {
+			mock.Reset()
+			close(reset)
+		}()
+		<-time.After(20 * time.Millisecond)
+
+		result := make(chan int, 1)
+		go func() { result <- test.Foo(2) }()
+		select {
+		case r := <-result:
+			s.Equal(2, r, "new call goes to origin while waiting check")
+		case <-time.After(time.Second):
+			s.Fail("new call enters mock while waiting")
+		}
+		select {
+		case <-reset:
+			s.Fail("reset before in-flight call finished")
+		default:
+		}
+		close(release)
+		<-reset
+	})
+}
+
+// TestUnitSuspend 测试暂停和恢复 mock
+func (s *mockerTestSuite) TestUnitSuspend() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		foo := mock.Func(test.Foo)
+		foo.When(1).Return(10).When(2).Return(20)
+		var before []interface{}
+		foo.Before(func(args []interface{}) {
+			before = append(before, args[0])
+		})
+		mock.Var(&test.GlobalVar).Set(2)
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").As(func(ctx *mocker.IContext, i int) int {
+			return 0
+		}).Return(5)
+
+		foo.Suspend()
+		s.True(foo.Suspended(), "suspended check")
+		s.Equal(1, test.Foo(1), "suspend func check")
+		s.Empty(before, "suspend layer check")
+		foo.Resume()
+		s.False(foo.Suspended(), "resumed check")
+		s.Equal(20, test.Foo(2), "resume keep when check")
+		s.Equal([]interface{}{2}, before, "resume layer check")
+
+		mock.Suspend()
+		s.Equal(1, test.Foo(1), "builder suspend func check")
+		s.Equal(1, test.GlobalVar, "builder suspend var check")
+		s.Nil(i, "builder suspend interface check")
+		mock.Resume()
+		s.Equal(10, test.Foo(1), "builder resume func check")
+		s.Equal(2, test.GlobalVar, "builder resume var check")
+		s.Equal(5, i.Call(0), "builder resume interface check")
+	})
+	s.Run("without mocks", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		other := mocker.Create()
+		defer other.Reset()
+
+		mock.Func(test.Foo).Return(10)
+		other.Var(&test.GlobalVar).Set(2)
+		suspended := other.Func(test.Foo1)
+		suspended.Return(&test.S{Field1: "mock"})
+		suspended.Suspend()
+
+		mocker.WithoutMocks(func() {
+			s.Equal(1, test.Foo(1), "without mocks func check")
+			s.Equal(1, test.GlobalVar, "without mocks var check")
+		})
+		s.Equal(10, test.Foo(1), "restore func check")
+		s.Equal(2, test.GlobalVar, "restore var check")
+		s.True(suspended.Suspended(), "keep suspended check")
+	})
+	s.Run("shared patch", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		tracer := mocker.Create()
+		defer tracer.Reset()
+
+		mock.Func(test.Foo).Return(10)
+		layer := tracer.Func(test.Foo).Before(func([]interface{}) {})
+		mock.Func(test.Foo).Suspend()
+		s.Equal(1, test.Foo(1), "suspend shared check")
+		layer.Cancel()
+		mock.Func(test.Foo).Resume()
+		s.Equal(10, test.Foo(1), "resume shared check")
+	})
+}
+
+// TestUnitIntegrity 测试 patch 指令的完整性校验和兜底还原
+func (s *mockerTestSuite) TestUnitIntegrity() {
+	s.Run("verify", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.Func(test.Foo).Return(10)
+		s.NoError(mocker.Verify(), "verify check")
+
+		// 模拟调试器在被 patch 的函数开头插入断点
+		addr := reflect.ValueOf(test.Foo).Pointer()
+		saved := memory.RawRead(addr, 1)
+		s.NoError(memory.WriteTo(addr, []byte{0xCC}))
+		err := mocker.Verify()
+		s.NoError(memory.WriteTo(addr, saved))
+
+		s.IsType(&erro.PatchCorrupted{}, err, "corrupted check")
+		s.Contains(err.Error(), "test.Foo", "corrupted func check")
+		s.NoError(mocker.Verify(), "verify after fix check")
+		s.Equal(10, test.Foo(1), "mock after fix check")
+	})
+	s.Run("restore all", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		other := mocker.Create()
+		defer other.Reset()
+
+		mock.Func(test.Foo).Return(10)
+		other.Func(test.Foo).Return(20)
+		s.Equal(20, test.Foo(1), "mock check")
+
+		s.GreaterOrEqual(mocker.RestoreAll(), 1, "restore count check")
+		s.Equal(1, test.Foo(1), "restore all check")
+		s.Empty(mocker.ActivePatches(), "no active patch check")
+		s.NoError(mocker.Verify(), "verify after restore check")
+	})
+	s.Run("restore on signal stop", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Foo).Return(10)
+
+		received := make(chan os.Signal, 1)
+		signal.Notify(received, os.Interrupt)
+		defer signal.Stop(received)
+		stop := mocker.RestoreOnSignal(os.Interrupt)
+		stop()
+		stop()
+
+		p, err := os.FindProcess(os.Getpid())
+		s.NoError(err)
+		if err = p.Signal(os.Interrupt); err != nil {
+			s.T().Skipf("send interrupt unsupported: %v", err)
+		}
+		<-received
+		<-time.After(20 * time.Millisecond)
+		s.Equal(10, test.Foo(1), "not restored after stop check")
+	})
+}
+
+// TestUnitBatch 测试批量应用 mock
+func (s *mockerTestSuite) TestUnitBatch() {
+	s.Run("success", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+
+		mock.Batch(func(b *mocker.Builder) {
+			b.Func(test.Foo).Return(10)
+			b.Func(test.Foo1).Return(&test.S{Field1: "mock"})
+			s.Equal(1, test.Foo(1), "not applied in batch check")
+		})
+		s.Equal(10, test.Foo(1), "batch applied check")
+		s.Equal("mock", test.Foo1().Field1, "batch applied check")
+		s.NoError(mocker.Verify(), "verify check")
+
+		mock.Reset()
+		s.Equal(1, test.Foo(1), "reset check")
+	})
+	s.Run("rollback", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Foo).Return(5)
+
+		s.Panics(func() {
+			mock.Batch(func(b *mocker.Builder) {
+				b.Func(test.Foo1).Return(&test.S{Field1: "mock"})
+				b.Func(test.Foo1).Return(100)
+			})
+		}, "batch failed check")
+		s.Equal(5, test.Foo(1), "existing mock check")
+		s.NotEqual("mock", test.Foo1().Field1, "rollback check")
+		s.NoError(mocker.Verify(), "verify check")
+	})
+	s.Run("rollback existing", func() {
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Foo).When(1).Return(5)
+		mock.Struct(&test.Fake{}).Method("Call").Return(7)
+		f := &test.Fake{}
+
+		s.Panics(func() {
+			mock.Batch(func(b *mocker.Builder) {
+				b.Func(test.Foo).When(2).Return(6).Return(8)
+				b.Func(test.Foo).Apply(func(i int) int { return 9 })
+				b.Struct(&test.Fake{}).Method("Call").Return(70)
+				b.Struct(&test.Fake{}).Method("Call2").Return(80)
+				b.Func(test.Foo1).Return(100)
+			})
+		}, "batch failed check")
+		s.Equal(5, test.Foo(1), "restore when check")
+		s.Panics(func() { test.Foo(2) }, "rollback when check")
+		s.Equal(7, f.Call(1), "restore cached method check")
+		s.Equal(1, f.Call2(1), "rollback new cached method check")
+		s.NoError(mocker.Verify(), "verify check")
+
+		mock.Reset()
+		s.Equal(3, test.Foo(3), "reset check")
+		s.Equal(1, f.Call(1), "reset cached method check")
+	})
+}
+
+// TestUnitWriteStrategy 测试写入方式的查询和指定
+func (s *mockerTestSuite) TestUnitWriteStrategy() {
+	s.Run("success", func() {
+		name, errs := mocker.WriteStrategy()
+		s.NotEmpty(name, "strategy check")
+		for _, err := range errs {
+			s.IsType(&erro.WriteStrategyUnavailable{}, err, "probe error type check")
+		}
+		defer func() {
+			s.NoError(mocker.UseWriteStrategy(name))
+		}()
+
+		s.IsType(&erro.WriteStrategyUnavailable{}, mocker.UseWriteStrategy("unknown"), "unknown strategy check")
+		if err := mocker.UseWriteStrategy(mocker.WriteStrategyProcMem); err != nil {
+			s.T().Skipf("skip %s: %v", mocker.WriteStrategyProcMem, err)
+		}
+		mock := mocker.Create()
+		defer mock.Reset()
+		mock.Func(test.Foo).Return(10)
+		s.Equal(10, test.Foo(1), "mock by proc mem check")
+		mock.Reset()
+		s.Equal(1, test.Foo(1), "reset by proc mem check")
+	})
+}
+
+// TestUnitStubReuse 测试取消 mock 之后回收跳板函数空间, 接口 mock 的桩函数不回收
+func (s *mockerTestSuite) TestUnitStubReuse() {
+	s.Run("success", func() {
+		before := mocker.StubUsage()
+		for n := 0; n < 3; n++ {
+			mock := mocker.Create()
+			spy := mock.Func(test.Foo).Spy()
+
+			s.Equal(2, test.Foo(2), "spy call origin check")
+			s.Equal(1, spy.Times(), "spy times check")
+			s.Greater(mocker.StubUsage().InUse, before.InUse, "stub in use check")
+
+			mock.Reset()
+			s.Equal(3, test.Foo(3), "reset check")
+			s.Equal(before.InUse, mocker.StubUsage().InUse, "stub released check")
+		}
+		after := mocker.StubUsage()
+		s.GreaterOrEqual(after.Reused-before.Reused, 2, "stub reused check")
+		// 只有第一次 Spy 可能从占位函数中新分配跳板函数, 之后都复用回收的空间
+		s.LessOrEqual(after.HolderUsed-before.HolderUsed, 3*64, "holder usage check")
+	})
+	s.Run("keep interface stubs", func() {
+		mock := mocker.Create()
+		i := (I)(nil)
+		mock.Interface(&i).Method("Call").As(func(ctx *mocker.IContext, i int) int {
+			return i * 2
+		}).Return(5)
+		copied := i
+		inUse := mocker.StubUsage().InUse
+		mock.Reset()
+		s.Nil(i, "interface reset check")
+		s.Equal(inUse, mocker.StubUsage().InUse, "interface stub kept check")
+
+		other := mocker.Create()
+		defer other.Reset()
+		j := (I)(nil)
+		other.Interface(&j).Method("Call").As(func(ctx *mocker.IContext, i int) int {
+			return i * 3
+		}).Return(7)
+		s.Equal(7, j.Call(1), "new interface mock check")
+		// 拷贝出去的接口值仍然调用到已经取消的 mock, 而不是复用了桩函数空间的其他 mock
+		s.PanicsWithValue("there is no suitable condition matched, or set default return with: mocker.Return(...)",
+			func() { copied.Call(1) }, "copied interface value check")
+	})
+	s.Run("retire shared origin", func() {
+		tracer := mocker.Create()
+		tracer.Func(test.Foo).Before(func(args []interface{}) {})
+		mock := mocker.Create()
+		var origin func(int) int
+		mock.Func(test.Foo).Origin(&origin).Apply(func(i int) int {
+			return origin(i) + 1
+		})
+		s.Equal(3, test.Foo(2), "shared origin check")
+
+		before := mocker.StubUsage()
+		mock.Reset()
+		tracer.Reset()
+		s.Equal(2, test.Foo(2), "reset check")
+		after := mocker.StubUsage()
+		s.Greater(after.Retired, before.Retired, "shared origin retired check")
+		s.Equal(before.Free, after.Free, "shared origin not reused check")
+
+		other := mocker.Create()
+		defer other.Reset()
+		other.Func(test.Foo1).Before(func(args []interface{}) {})
+		s.Equal("ok", test.Foo1().Field1, "new shared patch check")
+		// 仍然持有原函数变量的代码调用到原来的函数, 而不是复用了跳板函数空间的其他 patch
+		s.Equal(2, origin(2), "stale origin check")
+	})
 }
@@ -0,0 +1,136 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了跨 mocker 的调用顺序校验, 支持了 mocker.InOrder(m1, m2, m3).Verify(t)。
+package mocker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RecordedMocker 记录调用的 mocker
+type RecordedMocker interface {
+	Mocker
+	Recorder
+}
+
+// TestingT 校验失败时报告错误, testing.T 实现了该接口
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Order 调用顺序校验
+type Order struct {
+	steps [][]RecordedMocker
+}
+
+// unordered 组内的 mocker 之间不校验顺序
+type unordered []RecordedMocker
+
+// Unordered 组内的 mocker 之间不校验顺序, 组整体和前后的步骤校验顺序, 用于校验偏序关系
+// 比如: InOrder(lock, Unordered(read, stat), unlock), read 和 stat 都要在 lock 之后、unlock 之前调用
+// mocker 必须实现 RecordedMocker, 接口 mock 的 InterfaceMocker 也可以直接传入
+func Unordered(mockers ...Mocker) interface{} {
+	group := make(unordered, 0, len(mockers))
+	for i, m := range mockers {
+		r, ok := m.(RecordedMocker)
+		if !ok {
+			panic(fmt.Sprintf("Unordered(...) mocker[%d] does not record calls, actual %T", i, m))
+		}
+		group = append(group, r)
+	}
+	return group
+}
+
+// InOrder 指定调用顺序, 每一步为 RecordedMocker 或 Unordered(...)
+// 校验时只关注指定的 mocker 之间的先后顺序, 允许中间穿插其他调用
+func InOrder(steps ...interface{}) *Order {
+	o := &Order{steps: make([][]RecordedMocker, 0, len(steps))}
+	for i, step := range steps {
+		switch s := step.(type) {
+		case RecordedMocker:
+			o.steps = append(o.steps, []RecordedMocker{s})
+		case unordered:
+			if len(s) == 0 {
+				panic(fmt.Sprintf("InOrder(...) step[%d] Unordered(...) is empty", i))
+			}
+			o.steps = append(o.steps, s)
+		default:
+			panic(fmt.Sprintf("InOrder(...) step[%d] must be mocker or Unordered(...), actual %T", i, step))
+		}
+	}
+	return o
+}
+
+// Verify 校验调用顺序, 校验失败时通过 t 报告错误并返回 false
+func (o *Order) Verify(t TestingT) bool {
+	if err := o.check(); err != "" {
+		t.Errorf("%s\nobserved sequence:\n%s", err, o.observed())
+		return false
+	}
+	return true
+}
+
+// check 按照步骤依次查找序号递增的调用, 每一步取满足条件的最早调用
+func (o *Order) check() string {
+	var last int64
+	for i, step := range o.steps {
+		var stepLast int64
+		for _, m := range step {
+			c := firstCallAfter(m, last)
+			if c == nil {
+				return fmt.Sprintf("calls not in order: step[%d] mocker [%s] not called after seq #%d",
+					i, m.String(), last)
+			}
+			if c.Seq > stepLast {
+				stepLast = c.Seq
+			}
+		}
+		last = stepLast
+	}
+	return ""
+}
+
+// firstCallAfter 获取序号大于 seq 的最早的调用
+func firstCallAfter(m RecordedMocker, seq int64) *Call {
+	var first *Call
+	for _, c := range m.Invocations() {
+		if c.Seq > seq && (first == nil || c.Seq < first.Seq) {
+			first = c
+		}
+	}
+	return first
+}
+
+// observed 校验涉及的 mocker 的所有调用, 按照调用序号排序
+func (o *Order) observed() string {
+	type namedCall struct {
+		name string
+		*Call
+	}
+	var calls []namedCall
+	for _, step := range o.steps {
+		for _, m := range step {
+			for _, c := range m.Invocations() {
+				calls = append(calls, namedCall{name: m.String(), Call: c})
+			}
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Seq < calls[j].Seq
+	})
+
+	if len(calls) == 0 {
+		return "\t(no calls)"
+	}
+	lines := make([]string, 0, len(calls))
+	for i, c := range calls {
+		// 同一个 mocker 在多个步骤中出现时, 只打印一次
+		if i > 0 && calls[i-1].Call == c.Call {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("\t#%d [%s] args %v", c.Seq, c.name, c.Args))
+	}
+	return strings.Join(lines, "\n")
+}
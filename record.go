@@ -0,0 +1,334 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 mock 数据录制和回放, 录制时调用原函数并将参数、返回值写入 golden 文件,
+// 回放时从 golden 文件读取参数和返回值, 构造 Matches(arg.Pair{...}) 条件。
+package mocker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// RecordEnv 录制模式的环境变量, 值为 1 时强制重新录制
+const RecordEnv = "GOOM_RECORD"
+
+const (
+	// errorHint error 类型的值
+	errorHint = "$error"
+	// timeHint time.Time 类型的值
+	timeHint = "$time"
+	// bytesHint []byte 类型的值
+	bytesHint = "$bytes"
+)
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// record golden 文件中的一次调用记录
+type record struct {
+	Args    []json.RawMessage `json:"args"`
+	Results []json.RawMessage `json:"results"`
+}
+
+// recordGroup 参数相同的调用记录, 回放时按照录制的顺序依次返回, 最后一次的返回值重复返回
+type recordGroup struct {
+	args    []interface{}
+	results [][]interface{}
+}
+
+// isRecordMode 是否为录制模式: 环境变量开启或者 golden 文件不存在
+func isRecordMode(path string) bool {
+	if os.Getenv(RecordEnv) == "1" {
+		return true
+	}
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// record 录制或回放
+// 录制模式下执行原函数并记录调用, 在 Cancel 时写入 golden 文件; 回放模式下读取 golden 文件指定返回值
+func (m *baseMocker) record(path string, funcTyp reflect.Type, isMethod bool,
+	spy func() FuncMocker, when func() *When) {
+	if isRecordMode(path) {
+		spy()
+		m.recordPath = path
+		return
+	}
+	groups, err := loadRecords(path, funcTyp, isMethod)
+	if err != nil {
+		panic(fmt.Sprintf("load record file error: %v", err))
+	}
+	when().replay(path, groups)
+}
+
+// replay 按照录制的调用记录指定参数匹配和返回值, 参数相同的调用按照录制的顺序依次返回
+// 和 Matches 不同, 不设置默认返回值, 参数和所有录制的调用都不匹配时 panic, 使单测失败
+func (w *When) replay(path string, groups []*recordGroup) {
+	for _, g := range groups {
+		matcher := newDefaultMatch(w.name(), g.args, w.fillResults(g.results[0]), w.isMethod, w.funcTyp)
+		for _, results := range g.results[1:] {
+			matcher.AddResult(w.fillResults(results))
+		}
+		w.matches = append(w.matches, matcher)
+	}
+	w.defaultReturns = nil
+	w.replayPath = path
+}
+
+// saveRecords 将调用记录写入 golden 文件
+func (m *baseMocker) saveRecords() error {
+	calls := m.Invocations()
+	records := make([]*record, 0, len(calls))
+	for _, c := range calls {
+		if c.Panic != nil {
+			continue
+		}
+		args, err := encodeValues(c.Args, typesOf(c.args), true)
+		if err != nil {
+			return err
+		}
+		results, err := encodeValues(c.Results, typesOf(c.results), false)
+		if err != nil {
+			return err
+		}
+		records = append(records, &record{Args: args, Results: results})
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.recordPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.recordPath, data, 0644)
+}
+
+// loadRecords 读取 golden 文件, 按照函数签名还原参数和返回值, 参数相同的调用记录合并为一组
+func loadRecords(path string, funcTyp reflect.Type, isMethod bool) ([]*recordGroup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []*record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	inTypes := make([]reflect.Type, 0, funcTyp.NumIn())
+	for i := 0; i < funcTyp.NumIn(); i++ {
+		if isMethod && i == 0 {
+			continue
+		}
+		inTypes = append(inTypes, funcTyp.In(i))
+	}
+	outTypes := make([]reflect.Type, funcTyp.NumOut())
+	for i := range outTypes {
+		outTypes[i] = funcTyp.Out(i)
+	}
+
+	groups := make([]*recordGroup, 0, len(records))
+	byArgs := make(map[string]*recordGroup, len(records))
+	for i, r := range records {
+		results, err := decodeValues(r.Results, outTypes, false)
+		if err != nil {
+			return nil, fmt.Errorf("record[%d] results: %w", i, err)
+		}
+		key, err := argsKey(r.Args)
+		if err != nil {
+			return nil, fmt.Errorf("record[%d] args: %w", i, err)
+		}
+		if g, ok := byArgs[key]; ok {
+			g.results = append(g.results, results)
+			continue
+		}
+		args, err := decodeValues(r.Args, inTypes, true)
+		if err != nil {
+			return nil, fmt.Errorf("record[%d] args: %w", i, err)
+		}
+		g := &recordGroup{args: args, results: [][]interface{}{results}}
+		byArgs[key] = g
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// argsKey 序列化之后的参数去掉空白字符, 作为合并调用记录的 key
+func argsKey(raws []json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	for _, raw := range raws {
+		if err := json.Compact(&buf, raw); err != nil {
+			return "", err
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+// typesOf 获取参数或返回值声明的类型
+func typesOf(vs []reflect.Value) []reflect.Type {
+	types := make([]reflect.Type, len(vs))
+	for i, v := range vs {
+		if v.IsValid() {
+			types[i] = v.Type()
+		}
+	}
+	return types
+}
+
+// encodeValues 序列化参数或返回值, 声明为 error 类型的值以及 time.Time、[]byte 使用类型提示
+// types 参数或返回值声明的类型, 实现了 error 的具体类型(比如 *MyErr)按照原类型序列化, 回放时才能还原
+// isArg 为 true 时无法序列化的参数(比如 context.Context)记录为 $any, 回放时匹配任意值
+func encodeValues(vs []interface{}, types []reflect.Type, isArg bool) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, len(vs))
+	for i, v := range vs {
+		var hinted interface{} = v
+		if err, ok := v.(error); ok && i < len(types) && types[i] == errorType {
+			hinted = map[string]string{errorHint: err.Error()}
+		}
+		switch val := v.(type) {
+		case time.Time:
+			hinted = map[string]string{timeHint: val.Format(time.RFC3339Nano)}
+		case []byte:
+			if val != nil {
+				hinted = map[string]string{bytesHint: base64.StdEncoding.EncodeToString(val)}
+			}
+		}
+		data, err := json.Marshal(hinted)
+		if err != nil && isArg {
+			data, err = json.Marshal(map[string]string{anyHint: fmt.Sprintf("%T", v)})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encode value[%d] %T: %w", i, v, err)
+		}
+		result[i] = data
+	}
+	return result, nil
+}
+
+// decodeValues 按照类型反序列化参数或返回值
+// isArg 为 true 时反序列化为参数匹配条件: error 按照错误信息匹配, 接口类型和 $any 匹配任意值
+func decodeValues(raws []json.RawMessage, types []reflect.Type, isArg bool) ([]interface{}, error) {
+	if len(raws) != len(types) {
+		return nil, fmt.Errorf("value count not match, required %d, actual %d", len(types), len(raws))
+	}
+	result := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		decode := decodeValue
+		if isArg {
+			decode = decodeArg
+		}
+		v, err := decode(raw, types[i])
+		if err != nil {
+			return nil, fmt.Errorf("decode value[%d] %s: %w", i, types[i], err)
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// decodeArg 按照类型反序列化单个参数匹配条件
+// 录制的 error 和实际调用的 error 不是同一个对象, 按照错误信息匹配; 接口类型无法还原实际类型, 匹配任意值
+func decodeArg(raw json.RawMessage, typ reflect.Type) (interface{}, error) {
+	var hinted map[string]string
+	if json.Unmarshal(raw, &hinted) == nil {
+		if _, ok := hinted[anyHint]; ok {
+			return arg.Any(), nil
+		}
+	}
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return reflect.Zero(typ).Interface(), nil
+	}
+	if typ == errorType {
+		msg, ok := hinted[errorHint]
+		if !ok {
+			return nil, fmt.Errorf("missing %s hint", errorHint)
+		}
+		return &errorExpr{msg: msg}, nil
+	}
+	if typ.Kind() == reflect.Interface {
+		return arg.Any(), nil
+	}
+	return decodeValue(raw, typ)
+}
+
+// errorExpr 按照错误信息匹配 error 参数
+type errorExpr struct {
+	msg string
+}
+
+// Resolve errorExpr 表达式解析
+func (e *errorExpr) Resolve(types []reflect.Type) error {
+	if len(types) != 1 || !types[0].Implements(errorType) {
+		return fmt.Errorf("error message expr requires error type, actual %v", types)
+	}
+	return nil
+}
+
+// Eval 执行 errorExpr 表达式
+func (e *errorExpr) Eval(input []reflect.Value) (bool, error) {
+	if len(input) != 1 || !input[0].IsValid() || input[0].IsNil() {
+		return false, nil
+	}
+	err, ok := input[0].Interface().(error)
+	return ok && err.Error() == e.msg, nil
+}
+
+// decodeValue 按照类型反序列化单个值
+func decodeValue(raw json.RawMessage, typ reflect.Type) (interface{}, error) {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return reflect.Zero(typ).Interface(), nil
+	}
+
+	var hinted map[string]string
+	if typ == errorType || typ == timeType || typ == bytesType {
+		if err := json.Unmarshal(raw, &hinted); err != nil {
+			return nil, err
+		}
+	}
+	switch typ {
+	case errorType:
+		msg, ok := hinted[errorHint]
+		if !ok {
+			return nil, fmt.Errorf("missing %s hint", errorHint)
+		}
+		return errors.New(msg), nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339Nano, hinted[timeHint])
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	case bytesType:
+		return base64.StdEncoding.DecodeString(hinted[bytesHint])
+	}
+
+	v := reflect.New(typ)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// cancelRecord 取消 mock 时写入录制的调用记录
+func (m *baseMocker) cancelRecord() {
+	if m.recordPath == "" || m.canceled {
+		return
+	}
+	if err := m.saveRecords(); err != nil {
+		logger.Consolef(logger.ErrorLevel, "save record file %s error: %v", m.recordPath, err)
+	}
+}
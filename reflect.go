@@ -54,3 +54,16 @@ func outTypes(funTyp reflect.Type) []reflect.Type {
 	}
 	return typeList
 }
+
+// zeroResults 获取函数类型所有返回值的零值
+func zeroResults(funTyp reflect.Type) []interface{} {
+	return fillZero(make([]interface{}, 0, funTyp.NumOut()), funTyp)
+}
+
+// fillZero 使用零值补全未指定的返回值
+func fillZero(results []interface{}, funTyp reflect.Type) []interface{} {
+	for i := len(results); i < funTyp.NumOut(); i++ {
+		results = append(results, reflect.Zero(funTyp.Out(i)).Interface())
+	}
+	return results
+}
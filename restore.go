@@ -0,0 +1,74 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 patch 指令的完整性校验和兜底还原, 支持了 mocker.Verify() 检测被外部修改的指令,
+// 以及 mocker.RestoreAll() 和 mocker.RestoreOnSignal() 还原所有原函数的指令, 避免进程退出时遗留被修改的代码段。
+package mocker
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+
+	"github.com/tencent/goom/erro"
+	"github.com/tencent/goom/internal/hack"
+	"github.com/tencent/goom/internal/logger"
+	"github.com/tencent/goom/internal/patch"
+)
+
+// Verify 按照登记的校验和检查所有生效中的 patch, 指令被外部修改(比如调试器插入了断点)时返回 *erro.PatchCorrupted
+func Verify() error {
+	corruptions := patch.Verify()
+	if len(corruptions) == 0 {
+		return nil
+	}
+	funcs := make([]string, 0, len(corruptions))
+	for _, c := range corruptions {
+		name := "unknown"
+		if f := runtime.FuncForPC(c.Origin); f != nil {
+			name = f.Name()
+		}
+		funcs = append(funcs, fmt.Sprintf("%s(0x%x) expect %x, actual %x", name, c.Origin, c.Expect, c.Actual))
+	}
+	return erro.NewPatchCorruptedError(funcs)
+}
+
+// RestoreAll 还原所有 patch 过的函数的原始指令, 返回还原的函数数量
+// 还原之后已有的 mocker 不再生效, 仍然可以调用 Reset; 用于进程退出或者单测异常中断之前的兜底
+func RestoreAll() int {
+	hubLock.Lock()
+	hubs = make(map[interface{}]*patchHub)
+	plainPatches = make(map[interface{}][]*baseMocker)
+	patchOwners = make(map[*patch.Guard]*patchOwner)
+	hubLock.Unlock()
+	return patch.RestoreAll()
+}
+
+// RestoreOnSignal 收到 sigs 中的信号时还原所有原函数的指令, 再以退出码 1 结束进程, 返回取消注册的函数
+// sigs 为空时使用 os.Interrupt 和 SIGQUIT; 注册之后这些信号不再执行默认行为, 需要在 TestMain 等入口显式开启
+func RestoreOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = hack.SignalsToIgnore
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			// 收到信号时其他协程可能持有 hubLock, 只还原指令
+			n := patch.RestoreAll()
+			logger.Consolef(logger.WarningLevel, "received signal %s, restored %d patched funcs", sig, n)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
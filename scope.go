@@ -0,0 +1,174 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了按照协程树限定 mock 的生效范围, 支持了 mocker.CreateT(t) 和 mock.Scoped(ctx),
+// 限定了作用域的 mock 通过共享 patch 注册, 按照调用方协程所在的作用域分发到不同 builder 的 mock 实现,
+// 不在任何作用域内的调用执行原函数, 以便 t.Parallel 的单测之间互不影响。
+package mocker
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/tencent/goom/internal/hack"
+)
+
+// scopeLabel 标识 mock 作用域的 pprof label 名称
+const scopeLabel = "goom.scope"
+
+var (
+	// scopes 已注册的作用域, key 为协程的 pprof labels 指针
+	scopes = make(map[unsafe.Pointer]*mockScope)
+	// scopeIDs 已注册的作用域, key 为作用域 label 的值, 用于识别在作用域内修改了 labels 的协程
+	scopeIDs  = make(map[string]*mockScope)
+	scopeLock sync.RWMutex
+	// scopeSeq 作用域序号
+	scopeSeq int64
+)
+
+// ScopeT 作用域绑定的单测, testing.T 实现了该接口
+type ScopeT interface {
+	Name() string
+	Cleanup(func())
+}
+
+// mockScope mock 作用域, 对应一棵继承了相同 pprof labels 的协程树
+type mockScope struct {
+	name string
+	// id 作用域 label 的值
+	id string
+	// ctx 携带作用域 label 的 context
+	ctx context.Context
+	// parent 携带进入作用域之前协程 labels 的 context, 退出作用域时恢复
+	parent context.Context
+	// label 协程的 pprof labels 指针
+	label unsafe.Pointer
+}
+
+// CreateT 创建只在当前单测及其创建的协程内生效的 Mock 构建器, 单测结束时自动 Reset
+// 多个并行的单测可以同时 mock 同一个函数, 作用域之外的调用执行原函数
+func CreateT(t ScopeT) *Builder {
+	// callerDeps 当前的调用栈栈层次
+	const callerDeps = 2
+	b := newBuilder(currentPkg(callerDeps))
+	b.enterScope(context.Background(), t.Name())
+	t.Cleanup(func() {
+		b.Reset()
+		b.leaveScope()
+	})
+	return b
+}
+
+// Scoped 限定 builder 内的 mock 只在当前协程及其后续创建的协程内生效, 需要在 mock 之前调用
+// 作用域通过 pprof labels 标识, 作用域的 label 和协程原有的 labels 以及 ctx 中的 labels 合并, ctx 结束时退出作用域;
+// 在作用域内基于 mock.Context() 调用 pprof.Do 等添加 labels 的协程仍然属于当前作用域,
+// 通过 pprof.SetGoroutineLabels 替换了 labels 的协程不再属于当前作用域, 可以通过 pprof.SetGoroutineLabels(mock.Context()) 重新加入
+// 使用 -tags goom_nolinkname 构建时无法读取协程的 labels, 不支持限定作用域
+func (b *Builder) Scoped(ctx context.Context) *Builder {
+	b.enterScope(ctx, "")
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			b.leaveScope()
+		}()
+	}
+	return b
+}
+
+// Context 获取携带当前 builder 作用域的 context, 未限定作用域时返回 context.Background()
+// 不是由作用域内协程创建的协程(比如协程池)可以通过 pprof.SetGoroutineLabels(mock.Context()) 加入作用域
+func (b *Builder) Context() context.Context {
+	if b.scope == nil {
+		return context.Background()
+	}
+	return b.scope.ctx
+}
+
+// enterScope 当前协程进入新的作用域
+func (b *Builder) enterScope(ctx context.Context, name string) {
+	if b.scope != nil {
+		panic("builder is already scoped")
+	}
+	if len(b.mockers) > 0 {
+		panic("Scoped(ctx) must be called before any mock")
+	}
+	if !hack.ProfLabelSupported {
+		panic("scoped mock requires goroutine labels, which are not available with -tags goom_nolinkname")
+	}
+	seq := atomic.AddInt64(&scopeSeq, 1)
+	if name == "" {
+		name = fmt.Sprintf("scope-%d", seq)
+	}
+	s := &mockScope{
+		name:   name,
+		id:     fmt.Sprintf("%s#%d", name, seq),
+		parent: hack.LabelContext(context.Background(), hack.ProfLabel()),
+	}
+	// 保留协程原有的 labels, ctx 中同名的 label 优先
+	s.ctx = pprof.WithLabels(pprof.WithLabels(ctx, mergeLabels(s.parent, ctx)), pprof.Labels(scopeLabel, s.id))
+	pprof.SetGoroutineLabels(s.ctx)
+	s.label = hack.ProfLabel()
+
+	scopeLock.Lock()
+	scopes[s.label] = s
+	scopeIDs[s.id] = s
+	scopeLock.Unlock()
+	b.scope = s
+}
+
+// mergeLabels 按照顺序合并多个 context 中的 pprof labels, 同名的 label 以后面的为准
+func mergeLabels(ctx ...context.Context) pprof.LabelSet {
+	var labels []string
+	for _, c := range ctx {
+		pprof.ForLabels(c, func(key, value string) bool {
+			labels = append(labels, key, value)
+			return true
+		})
+	}
+	return pprof.Labels(labels...)
+}
+
+// leaveScope 退出作用域, 在进入作用域的协程中调用时恢复协程原来的 labels
+func (b *Builder) leaveScope() {
+	s := b.scope
+	if s == nil {
+		return
+	}
+	scopeLock.Lock()
+	delete(scopes, s.label)
+	delete(scopeIDs, s.id)
+	scopeLock.Unlock()
+	if hack.ProfLabel() == s.label {
+		pprof.SetGoroutineLabels(s.parent)
+	}
+}
+
+// currentScope 获取当前协程所在的作用域, 不在任何作用域内时返回 nil
+// 协程的 labels 和进入作用域时一致时直接按照指针查找, 否则读取 labels 中的作用域 label
+func currentScope() *mockScope {
+	label := hack.ProfLabel()
+	if label == nil {
+		return nil
+	}
+	scopeLock.RLock()
+	s, ok := scopes[label]
+	scopeLock.RUnlock()
+	if ok {
+		return s
+	}
+	id, ok := pprof.Label(hack.LabelContext(context.Background(), label), scopeLabel)
+	if !ok {
+		return nil
+	}
+	scopeLock.RLock()
+	defer scopeLock.RUnlock()
+	return scopeIDs[id]
+}
+
+// scoped 是否限定了作用域
+func (m *baseMocker) scoped() bool {
+	return m.builder != nil && m.builder.scope != nil
+}
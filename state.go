@@ -0,0 +1,148 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了有状态的 mock, 多个 Mocker 可以共享同一个状态机,
+// 支持了 mocker.When(XXX).InState("up").Return(YYY).Transition("down")的状态匹配和迁移。
+package mocker
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// stateSeq 状态的创建序号, 同时锁定多个状态时按照序号加锁, 避免死锁
+var stateSeq uint64
+
+// State 命名状态, 在同一个 Builder 内按名称共享
+// 函数、方法、接口的 Mocker 可以通过同一个 State 相互影响返回结果
+type State struct {
+	id      uint64
+	name    string
+	initial string
+	current string
+	lock    sync.Mutex
+}
+
+// newState 创建状态
+func newState(name string) *State {
+	return &State{id: atomic.AddUint64(&stateSeq, 1), name: name}
+}
+
+// Name 状态机名称
+func (s *State) Name() string {
+	return s.name
+}
+
+// Init 设置初始状态, Builder Reset 时会恢复到初始状态
+func (s *State) Init(name string) *State {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.initial = name
+	s.current = name
+	return s
+}
+
+// Set 设置当前状态
+func (s *State) Set(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.current = name
+}
+
+// Current 当前状态
+func (s *State) Current() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.current
+}
+
+// Is 判断当前状态是否为 name
+func (s *State) Is(name string) bool {
+	return s.Current() == name
+}
+
+// reset 恢复到初始状态
+func (s *State) reset() {
+	s.Set(s.initial)
+}
+
+// stateClause 状态条件或状态迁移
+type stateClause struct {
+	state *State
+	name  string
+}
+
+// stateMatcher 支持状态条件和状态迁移的匹配器
+type stateMatcher interface {
+	addInState(c *stateClause)
+	addTransition(c *stateClause)
+	// enterState 满足所有状态条件时执行状态迁移, 条件判断和迁移在状态锁内原子完成
+	enterState() bool
+}
+
+// stateOwner 可以按照名称查找状态的 mocker
+type stateOwner interface {
+	// lookupState 查找 builder 内的命名状态, name 为空时返回 builder 内唯一的状态
+	lookupState(name string) *State
+}
+
+// lookupState 查找创建当前 mocker 的 builder 内的命名状态, name 为空时返回 builder 内唯一的状态
+func (m *baseMocker) lookupState(name string) *State {
+	if m.builder == nil {
+		return nil
+	}
+	if name != "" {
+		return m.builder.State(name)
+	}
+	if len(m.builder.states) != 1 {
+		return nil
+	}
+	for _, st := range m.builder.states {
+		return st
+	}
+	return nil
+}
+
+// enterState 同时锁定条件和迁移涉及的所有状态, 满足所有状态条件时执行状态迁移
+// 避免并发调用时多个协程同时匹配到迁移之前的状态
+func enterState(inStates, transitions []*stateClause) bool {
+	if len(inStates) == 0 && len(transitions) == 0 {
+		return true
+	}
+	states := lockStates(inStates, transitions)
+	defer func() {
+		for i := len(states) - 1; i >= 0; i-- {
+			states[i].lock.Unlock()
+		}
+	}()
+	for _, s := range inStates {
+		if s.state.current != s.name {
+			return false
+		}
+	}
+	for _, s := range transitions {
+		s.state.current = s.name
+	}
+	return true
+}
+
+// lockStates 按照创建序号锁定状态子句涉及的所有状态, 返回加锁的状态
+func lockStates(clauses ...[]*stateClause) []*State {
+	seen := make(map[*State]bool)
+	var states []*State
+	for _, cs := range clauses {
+		for _, c := range cs {
+			if !seen[c.state] {
+				seen[c.state] = true
+				states = append(states, c.state)
+			}
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].id < states[j].id
+	})
+	for _, st := range states {
+		st.lock.Lock()
+	}
+	return states
+}
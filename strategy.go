@@ -0,0 +1,29 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 .text 区内存写入方式的查询和指定, 支持了 mocker.WriteStrategy() 和 mocker.UseWriteStrategy(name),
+// 在限制了修改代码段权限的环境下(比如 SELinux execmod), 初始化时自动探测并降级为 /proc/self/mem 或 memfd 写入。
+package mocker
+
+import (
+	"github.com/tencent/goom/internal/bytecode/memory"
+)
+
+// 可以指定的写入方式
+const (
+	// WriteStrategyMprotect 通过 mprotect 临时修改内存页权限之后写入
+	WriteStrategyMprotect = string(memory.StrategyMprotect)
+	// WriteStrategyProcMem 通过 /proc/self/mem 写入
+	WriteStrategyProcMem = string(memory.StrategyProcMem)
+	// WriteStrategyMemfd 将代码页重新映射为 memfd 的共享映射之后写入
+	WriteStrategyMemfd = string(memory.StrategyMemfd)
+)
+
+// WriteStrategy 获取当前使用的写入方式, 以及初始化时探测到的不可用的写入方式的错误(*erro.WriteStrategyUnavailable)
+func WriteStrategy() (string, []error) {
+	return string(memory.CurrentStrategy()), memory.ProbeErrors()
+}
+
+// UseWriteStrategy 指定写入方式, 当前平台不支持时返回 *erro.WriteStrategyUnavailable
+func UseWriteStrategy(name string) error {
+	return memory.UseStrategy(memory.Strategy(name))
+}
@@ -0,0 +1,78 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了桩函数和跳板函数空间的回收, 取消 mock 时将生成的空间放回内存池复用,
+// 支持了 mocker.StubUsage() 查询可执行内存的使用情况, 避免大量单测反复 mock 时耗尽占位函数空间。
+package mocker
+
+import (
+	"reflect"
+
+	"github.com/tencent/goom/internal/bytecode/stub"
+	"github.com/tencent/goom/internal/proxy"
+)
+
+// StubStats 桩函数和跳板函数可执行内存的使用情况
+type StubStats struct {
+	// Slabs 通过 mmap 申请的内存块数量
+	Slabs int
+	// SlabBytes 通过 mmap 申请的内存总大小
+	SlabBytes int
+	// HolderBytes 占位函数的总大小, 跳板函数需要和被 patch 的函数地址相近, 只能从占位函数中分配
+	HolderBytes int
+	// HolderUsed 占位函数中已经分配的大小, 包含等待复用的空间
+	HolderUsed int
+	// InUse 使用中的桩函数和跳板函数数量
+	InUse int
+	// InUseBytes 使用中的空间大小
+	InUseBytes int
+	// Free 已经回收、等待复用的空间数量
+	Free int
+	// FreeBytes 已经回收、等待复用的空间大小
+	FreeBytes int
+	// Reused 累计复用回收空间的次数
+	Reused int
+	// Retired 已经回收但是不再复用的空间数量, 包括短跳转桩函数和拷贝给 Origin 指定的原函数变量的跳板函数,
+	// 避免进行中的调用或者仍然持有原函数的代码执行到被复用的空间
+	Retired int
+	// RetiredBytes 已经回收但是不再复用的空间大小
+	RetiredBytes int
+}
+
+// StubUsage 获取桩函数和跳板函数可执行内存的使用情况
+func StubUsage() StubStats {
+	s := stub.ReadStats()
+	return StubStats{
+		Slabs:        s.Slabs,
+		SlabBytes:    s.SlabBytes,
+		HolderBytes:  s.HolderBytes,
+		HolderUsed:   s.HolderUsed,
+		InUse:        s.InUse,
+		InUseBytes:   s.InUseBytes,
+		Free:         s.Free,
+		FreeBytes:    s.FreeBytes,
+		Reused:       s.Reused,
+		Retired:      s.Retired,
+		RetiredBytes: s.RetiredBytes,
+	}
+}
+
+// autoTrampoline 自动生成跳板函数, 记录指令地址以便取消时回收
+func (m *baseMocker) autoTrampoline(funcTyp reflect.Type) (interface{}, error) {
+	origin, err := proxy.AutoTrampoline(funcTyp)
+	if err != nil {
+		return nil, err
+	}
+	m.trampolines = append(m.trampolines, reflect.ValueOf(origin).Elem().Pointer())
+	return origin, nil
+}
+
+// releaseTrampolines 回收自动生成的跳板函数, 需要在恢复原函数之后调用
+// 仍然有进行中的调用时不回收, 避免正在执行的跳板函数被复用
+func (m *baseMocker) releaseTrampolines() {
+	if m.active.count() == 0 {
+		for _, addr := range m.trampolines {
+			proxy.ReleaseTrampoline(addr)
+		}
+	}
+	m.trampolines = nil
+}
@@ -0,0 +1,235 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 mock 的暂停和恢复, 支持了 mocker.Suspend()/Resume()、mock.Suspend()/Resume()
+// 以及 mocker.WithoutMocks(fn), 暂停期间调用执行原函数, 恢复之后仍然使用之前设定的 When、Return 等。
+package mocker
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/tencent/goom/anchor"
+)
+
+var (
+	// liveBuilders 存在 mocker 的构建器, Reset 之后移除
+	liveBuilders = make(map[*Builder]struct{})
+	builderLock  sync.Mutex
+)
+
+// Suspend 暂停 Mock, 调用执行原函数, 保留 When、Return 等设置, 可以通过 Resume 恢复
+// 同一个函数上的其他 mock 和拦截层不受影响
+func (m *baseMocker) Suspend() {
+	if m.canceled || m.suspended {
+		return
+	}
+	if m.guard != nil {
+		m.guard.Suspend()
+	}
+	m.suspendLayers(true)
+	m.suspended = true
+}
+
+// Resume 恢复暂停的 Mock
+func (m *baseMocker) Resume() {
+	if m.canceled || !m.suspended {
+		return
+	}
+	if m.guard != nil {
+		m.guard.Resume()
+	}
+	m.suspendLayers(false)
+	m.suspended = false
+}
+
+// Suspended 是否被暂停
+func (m *baseMocker) Suspended() bool {
+	return m.suspended
+}
+
+// suspendLayers 暂停或者恢复 mocker 添加的拦截层
+func (m *baseMocker) suspendLayers(suspended bool) {
+	for _, l := range m.layers {
+		l.hub.lock.Lock()
+		l.suspended = suspended
+		l.hub.lock.Unlock()
+	}
+}
+
+// Suspend 暂停所有方法的 mock
+func (m *CachedMethodMocker) Suspend() {
+	for _, v := range m.mCache {
+		v.Suspend()
+	}
+	for _, v := range m.umCache {
+		suspendMocker(v)
+	}
+	m.suspended = true
+}
+
+// Resume 恢复所有方法的 mock
+func (m *CachedMethodMocker) Resume() {
+	for _, v := range m.mCache {
+		v.Resume()
+	}
+	for _, v := range m.umCache {
+		resumeMocker(v)
+	}
+	m.suspended = false
+}
+
+// Suspend 暂停所有方法的 mock
+func (m *CachedUnexportedMethodMocker) Suspend() {
+	for _, v := range m.mockers {
+		v.Suspend()
+	}
+	m.suspended = true
+}
+
+// Resume 恢复所有方法的 mock
+func (m *CachedUnexportedMethodMocker) Resume() {
+	for _, v := range m.mockers {
+		v.Resume()
+	}
+	m.suspended = false
+}
+
+// Suspend 暂停接口的 mock, 接口变量恢复为原始值
+// 同一个接口变量的所有方法共享代理, 暂停任意一个方法都会暂停整个接口的 mock
+func (m *CachedInterfaceMocker) Suspend() {
+	for _, v := range m.mockers {
+		suspendMocker(v)
+	}
+	m.suspended = true
+}
+
+// Resume 恢复接口的 mock
+func (m *CachedInterfaceMocker) Resume() {
+	for _, v := range m.mockers {
+		resumeMocker(v)
+	}
+	m.suspended = false
+}
+
+// Suspend 暂停变量 mock, 变量恢复为原始值
+func (m *defaultVarMocker) Suspend() {
+	if m.canceled || m.suspended || m.mockValue == nil {
+		return
+	}
+	m.targetValue.Elem().Set(reflect.ValueOf(m.originValue))
+	m.suspended = true
+}
+
+// Resume 恢复变量 mock, 变量重新设置为 mock 值
+func (m *defaultVarMocker) Resume() {
+	if m.canceled || !m.suspended {
+		return
+	}
+	m.targetValue.Elem().Set(reflect.ValueOf(m.mockValue))
+	m.suspended = false
+}
+
+// Suspended 是否被暂停
+func (m *defaultVarMocker) Suspended() bool {
+	return m.suspended
+}
+
+// Suspend 暂停锚点的注入行为
+func (m *AnchorMocker) Suspend() {
+	if m.canceled || m.suspended {
+		return
+	}
+	anchor.Deactivate(m.name, m)
+	m.suspended = true
+}
+
+// Resume 恢复锚点的注入行为
+func (m *AnchorMocker) Resume() {
+	if m.canceled || !m.suspended {
+		return
+	}
+	m.suspended = false
+	if m.handler != nil {
+		m.activate()
+	}
+}
+
+// Suspend 按照创建的逆序暂停当前 builder 的所有 Mock, 可以通过 Resume 恢复
+// 比如先暂停 mock, 通过真实的依赖准备数据, 再恢复 mock
+func (b *Builder) Suspend() *Builder {
+	for i := len(b.order) - 1; i >= 0; i-- {
+		if mocker := b.mockers[b.order[i]]; !mocker.Canceled() {
+			suspendMocker(mocker)
+		}
+	}
+	return b
+}
+
+// Resume 按照创建的顺序恢复当前 builder 所有暂停的 Mock
+func (b *Builder) Resume() *Builder {
+	for _, key := range b.order {
+		if mocker := b.mockers[key]; !mocker.Canceled() {
+			resumeMocker(mocker)
+		}
+	}
+	return b
+}
+
+// WithoutMocks 暂停所有生效中的 Mock, 执行 fn 之后恢复, fn 中的调用执行原函数
+// 只暂停全局生效的 mock 和当前协程所在作用域的 mock, 不影响其他并行单测的 mock; 已经暂停的 mock 执行之后仍然保持暂停
+func WithoutMocks(fn func()) {
+	scope := currentScope()
+	builderLock.Lock()
+	builders := make([]*Builder, 0, len(liveBuilders))
+	for b := range liveBuilders {
+		if b.scope == nil || b.scope == scope {
+			builders = append(builders, b)
+		}
+	}
+	builderLock.Unlock()
+
+	var suspended []Suspender
+	for _, b := range builders {
+		for i := len(b.order) - 1; i >= 0; i-- {
+			mocker := b.mockers[b.order[i]]
+			if s, ok := mocker.(Suspender); ok && !mocker.Canceled() && !s.Suspended() {
+				s.Suspend()
+				suspended = append(suspended, s)
+			}
+		}
+	}
+	defer func() {
+		for i := len(suspended) - 1; i >= 0; i-- {
+			suspended[i].Resume()
+		}
+	}()
+	fn()
+}
+
+// register 登记存在 mocker 的构建器, 用于 WithoutMocks
+func (b *Builder) register() {
+	builderLock.Lock()
+	defer builderLock.Unlock()
+	liveBuilders[b] = struct{}{}
+}
+
+// unregister 移除 Reset 之后的构建器
+func (b *Builder) unregister() {
+	builderLock.Lock()
+	defer builderLock.Unlock()
+	delete(liveBuilders, b)
+}
+
+// suspendMocker 暂停 mocker, 没有实现 Suspender 的 mocker 不处理
+func suspendMocker(m Mocker) {
+	if s, ok := m.(Suspender); ok {
+		s.Suspend()
+	}
+}
+
+// resumeMocker 恢复 mocker, 没有实现 Suspender 的 mocker 不处理
+func resumeMocker(m Mocker) {
+	if s, ok := m.(Suspender); ok {
+		s.Resume()
+	}
+}
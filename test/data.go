@@ -1,7 +1,14 @@
 // Package test 兼容性测试、跨包结构测试工具类
 package test
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tencent/goom/anchor"
+)
 
 // GlobalVar 用于测试全局变量 mock
 var GlobalVar = 1
@@ -25,6 +32,13 @@ func foo(i int) int {
 	return i * 1
 }
 
+// InvokeFoo 测试按照调用方限定 mock 的生效范围
+//
+//go:noinline
+func InvokeFoo(i int) int {
+	return Foo(i)
+}
+
 // Invokefoo foo 测试调用未导出函数
 //
 //go:noinline
@@ -116,3 +130,94 @@ func Foo1() *S {
 func GetS() ([]byte, error) {
 	return []byte("hello"), nil
 }
+
+// Config 测试出参回填的结构体
+type Config struct {
+	Name string
+	size int
+}
+
+// Size 获取未导出属性 size
+func (c *Config) Size() int {
+	return c.size
+}
+
+// Load 测试通过指针参数回填结果
+//
+//go:noinline
+func Load(key string, out *Config) error {
+	if out == nil {
+		return fmt.Errorf("out is nil: %s", key)
+	}
+	out.Name = key
+	return nil
+}
+
+// Ratio 测试 float32 返回值
+//
+//go:noinline
+func Ratio(x float32) float32 {
+	return x
+}
+
+// Stat 测试多个返回值
+//
+//go:noinline
+func Stat(name string) (int64, uint32, string, *S, error) {
+	return int64(len(name)), 1, name, &S{Field1: name}, nil
+}
+
+// Fetch 测试录制和回放, 返回值包含[]byte、time.Time 和 error
+//
+//go:noinline
+func Fetch(key string) ([]byte, time.Time, error) {
+	if key == "" {
+		return nil, time.Time{}, errors.New("empty key")
+	}
+	return []byte("value:" + key), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// Publish 测试录制回放接口类型和 error 类型的参数
+//
+//go:noinline
+func Publish(ctx context.Context, cause error, topic string) (int, error) {
+	if cause != nil {
+		return 0, fmt.Errorf("publish %s: %w", topic, cause)
+	}
+	return len(topic), ctx.Err()
+}
+
+// RetryErr 测试录制回放实现了 error 的具体类型
+type RetryErr struct {
+	Code int `json:"code"`
+}
+
+// Error 错误信息
+func (e *RetryErr) Error() string {
+	return fmt.Sprintf("retry later: %d", e.Code)
+}
+
+// attempts Attempt 的调用次数
+var attempts = map[string]int{}
+
+// Attempt 测试录制回放参数相同、返回值不同的调用, 每个 key 第一次调用失败, 之后成功
+//
+//go:noinline
+func Attempt(key string) (int, *RetryErr) {
+	attempts[key]++
+	if attempts[key] == 1 {
+		return 0, &RetryErr{Code: 503}
+	}
+	return attempts[key], nil
+}
+
+// Commit 测试 mock 锚点, 锚点中的 panic 转换为 error 返回
+func Commit(id int) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("commit %d: %v", id, p)
+		}
+	}()
+	anchor.At("payment.beforeCommit", id)
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了结构化的调用日志, 在 Reset 时导出为 JSON Lines 或 Chrome trace_event 格式,
+// 以便在 trace viewer(比如 chrome://tracing、Perfetto)中分析复杂的并发单测。
+package mocker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/internal/logger"
+)
+
+// TraceFormat 调用日志导出格式
+type TraceFormat int
+
+const (
+	// TraceJSONLines 每行一条 JSON 格式的调用记录
+	TraceJSONLines TraceFormat = iota
+	// TraceChrome Chrome trace_event 格式, 每个协程对应一个线程轨道
+	TraceChrome
+)
+
+// callLog 调用日志
+type callLog struct {
+	calls []*Call
+	lock  sync.Mutex
+	// tracing 是否开启了调用日志, 通过 TraceTo 开启, 未开启时不记录
+	tracing bool
+}
+
+// enable 开启调用日志
+func (l *callLog) enable() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.tracing = true
+}
+
+// enabled 是否开启了调用日志
+func (l *callLog) enabled() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.tracing
+}
+
+// add 添加调用记录, 未开启调用日志时忽略
+func (l *callLog) add(c *Call) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.tracing {
+		l.calls = append(l.calls, c)
+	}
+}
+
+// drain 取出所有的调用记录, 按照调用序号排序
+func (l *callLog) drain() []*Call {
+	l.lock.Lock()
+	calls := l.calls
+	l.calls = nil
+	l.lock.Unlock()
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].Seq < calls[j].Seq
+	})
+	return calls
+}
+
+// traceEntry JSON Lines 格式的调用记录
+type traceEntry struct {
+	Time      string `json:"time"`
+	Seq       int64  `json:"seq"`
+	Goroutine int64  `json:"goroutine"`
+	Mocker    string `json:"mocker"`
+	Caller    string `json:"caller"`
+	Args      string `json:"args"`
+	Results   string `json:"results"`
+	Panic     string `json:"panic,omitempty"`
+	Duration  int64  `json:"duration_ns"`
+}
+
+// chromeEvent Chrome trace_event 格式的事件
+type chromeEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur"`
+	Pid  int                    `json:"pid"`
+	Tid  int64                  `json:"tid"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// TraceTo Reset 时将当前 builder 内所有 mocker 的调用日志导出到 path
+// 调用之后才开始记录调用日志, 未调用时不记录, 避免长时间运行的单测中调用日志持续增长
+// 比如: mock.TraceTo("testdata/calls.json", mocker.TraceChrome), 导出后在 chrome://tracing 中打开
+func (b *Builder) TraceTo(path string, format TraceFormat) *Builder {
+	b.tracePath = path
+	b.traceFormat = format
+	b.callLog.enable()
+	return b
+}
+
+// exportTrace 导出调用日志
+func (b *Builder) exportTrace() {
+	calls := b.callLog.drain()
+	if b.tracePath == "" {
+		return
+	}
+	if err := writeTrace(b.tracePath, b.traceFormat, calls); err != nil {
+		logger.Consolef(logger.ErrorLevel, "export trace %s error: %v", b.tracePath, err)
+	}
+}
+
+// writeTrace 按照格式写入调用日志
+func writeTrace(path string, format TraceFormat, calls []*Call) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	switch format {
+	case TraceJSONLines:
+		err = writeJSONLines(w, calls)
+	case TraceChrome:
+		err = writeChromeTrace(w, calls)
+	default:
+		err = fmt.Errorf("unknown trace format: %d", format)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// writeJSONLines 写入 JSON Lines 格式的调用日志
+func writeJSONLines(w *bufio.Writer, calls []*Call) error {
+	enc := json.NewEncoder(w)
+	for _, c := range calls {
+		e := &traceEntry{
+			Seq:       c.Seq,
+			Goroutine: c.Goroutine,
+			Mocker:    c.Mocker,
+			Caller:    c.Caller,
+			Args:      arg.SprintV(c.args),
+			Results:   arg.SprintV(c.results),
+			Duration:  int64(c.Duration),
+		}
+		if !c.Time.IsZero() {
+			e.Time = c.Time.Format(time.RFC3339Nano)
+		}
+		if c.Panic != nil {
+			e.Panic = fmt.Sprintf("%v", c.Panic)
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChromeTrace 写入 Chrome trace_event 格式的调用日志
+func writeChromeTrace(w *bufio.Writer, calls []*Call) error {
+	events := make([]*chromeEvent, 0, len(calls))
+	for _, c := range calls {
+		args := map[string]interface{}{
+			"seq":     c.Seq,
+			"caller":  c.Caller,
+			"args":    arg.SprintV(c.args),
+			"results": arg.SprintV(c.results),
+		}
+		if c.Panic != nil {
+			args["panic"] = fmt.Sprintf("%v", c.Panic)
+		}
+		events = append(events, &chromeEvent{
+			Name: c.Mocker,
+			Cat:  "goom",
+			Ph:   "X",
+			Ts:   float64(c.Time.UnixNano()) / float64(time.Microsecond),
+			Dur:  float64(c.Duration) / float64(time.Microsecond),
+			Pid:  os.Getpid(),
+			Tid:  c.Goroutine,
+			Args: args,
+		})
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ns",
+	})
+}
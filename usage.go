@@ -0,0 +1,250 @@
+// Package mocker 定义了 mock 的外层用户使用 API 定义,
+// 包括函数、方法、接口、未导出函数(或方法的)的 Mocker 的实现。
+// 当前文件实现了 mock 使用情况的统计, 在 Reset 时报告声明之后从未被调用的 mocker 和条件,
+// 并支持将一个包内所有单测的统计结果汇总到文件, 用于清理失效的 mock 定义。
+package mocker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tencent/goom/internal/logger"
+)
+
+// UsageEnv 使用情况汇总文件的环境变量, 比如 GOOM_USAGE=goom-usage.json
+// 设置之后所有 builder 在 Reset 时都会将使用情况汇总到该文件
+const UsageEnv = "GOOM_USAGE"
+
+// goomPkg 当前模块的包路径, 统计声明位置时跳过模块内部的调用栈
+var goomPkg = reflect.TypeOf(Builder{}).PkgPath()
+
+// usageLock 汇总文件的写锁
+var usageLock sync.Mutex
+
+// Usage mocker 或者条件的使用情况
+type Usage struct {
+	// Mocker mocker 名称
+	Mocker string `json:"mocker"`
+	// Clause 条件描述, 比如 when[0]、default; 为空时表示 mocker 本身
+	Clause string `json:"clause,omitempty"`
+	// Site 声明的代码位置, 格式为 file:line
+	Site string `json:"site"`
+	// Hits 调用(或匹配成功)的次数
+	Hits int64 `json:"hits"`
+}
+
+// key 汇总时的唯一标识
+func (u *Usage) key() string {
+	return u.Mocker + "|" + u.Clause + "|" + u.Site
+}
+
+// sortUsages 按照 mocker 名称、条件、声明位置排序
+func sortUsages(usages []*Usage) {
+	sort.Slice(usages, func(i, j int) bool {
+		a, b := usages[i], usages[j]
+		if a.Mocker != b.Mocker {
+			return a.Mocker < b.Mocker
+		}
+		if a.Clause != b.Clause {
+			return a.Clause < b.Clause
+		}
+		return a.Site < b.Site
+	})
+}
+
+// String 使用情况描述
+func (u *Usage) String() string {
+	name := "mocker [" + u.Mocker + "]"
+	if u.Clause != "" {
+		name = name + " " + u.Clause
+	}
+	return fmt.Sprintf("%s declared at %s, hits %d", name, u.Site, u.Hits)
+}
+
+// ReportUnused Reset 时打印声明之后从未被调用的 mocker 和条件
+func (b *Builder) ReportUnused() *Builder {
+	b.reportUnused = true
+	return b
+}
+
+// Usages 当前 builder 内所有 mocker 和条件的使用情况
+func (b *Builder) Usages() []*Usage {
+	var usages []*Usage
+	for _, m := range b.mockers {
+		usages = append(usages, collectUsages(m)...)
+	}
+	sortUsages(usages)
+	return usages
+}
+
+// reportUsage 报告使用情况, 需要在取消 mock 之前调用
+func (b *Builder) reportUsage() {
+	file := os.Getenv(UsageEnv)
+	if !b.reportUnused && file == "" {
+		return
+	}
+	usages := b.Usages()
+	if b.reportUnused {
+		for _, u := range usages {
+			if u.Hits == 0 {
+				logger.Consolef(logger.WarningLevel, "unused mock: %s", u)
+			}
+		}
+	}
+	if file != "" {
+		if err := mergeUsageFile(file, usages); err != nil {
+			logger.Consolef(logger.ErrorLevel, "write usage file %s error: %v", file, err)
+		}
+	}
+}
+
+// collectUsages 收集 mocker 及其条件的使用情况
+func collectUsages(m Mocker) []*Usage {
+	var usages []*Usage
+	switch v := m.(type) {
+	case *CachedMethodMocker:
+		for _, c := range v.mCache {
+			usages = append(usages, collectUsages(c)...)
+		}
+		for _, c := range v.umCache {
+			usages = append(usages, collectUsages(c)...)
+		}
+		return usages
+	case *CachedUnexportedMethodMocker:
+		for _, c := range v.mockers {
+			usages = append(usages, collectUsages(c)...)
+		}
+		return usages
+	case *CachedInterfaceMocker:
+		for _, c := range v.mockers {
+			usages = append(usages, collectUsages(c)...)
+		}
+		return usages
+	}
+
+	b, ok := m.(interface{ base() *baseMocker })
+	if !ok || m.Canceled() {
+		return nil
+	}
+	return b.base().usages(m.String())
+}
+
+// base 获取基础 mocker
+func (m *baseMocker) base() *baseMocker {
+	return m
+}
+
+// usages mocker 及其条件的使用情况
+func (m *baseMocker) usages(name string) []*Usage {
+	usages := []*Usage{{Mocker: name, Site: m.site, Hits: int64(m.Times())}}
+	if m.when == nil {
+		return usages
+	}
+
+	seen := make(map[Matcher]bool, len(m.when.matches)+1)
+	add := func(c Matcher, clause string) {
+		u, ok := c.(usageMatcher)
+		if !ok || seen[c] {
+			return
+		}
+		seen[c] = true
+		site, hits := u.usage()
+		usages = append(usages, &Usage{Mocker: name, Clause: clause, Site: site, Hits: hits})
+	}
+	for i, c := range m.when.matches {
+		if c == m.when.defaultReturns {
+			continue
+		}
+		add(c, fmt.Sprintf("when[%d]", i))
+	}
+	if _, empty := m.when.defaultReturns.(*EmptyMatch); !empty && m.when.defaultReturns != nil {
+		add(m.when.defaultReturns, "default")
+	}
+	return usages
+}
+
+// declSite 获取声明的代码位置, 跳过当前模块和反射的调用栈
+func declSite() string {
+	const maxDepth = 32
+	pcs := make([]uintptr, maxDepth)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !isInternalFrame(f.Function) {
+			return path.Base(f.File) + ":" + fmt.Sprint(f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isInternalFrame 是否为 mocker 包、arg 包、internal 下的包或者反射的调用栈
+// 按照包路径精确匹配, 路径前缀相同的其他包(比如下游的 goom/xxx 包)不跳过
+func isInternalFrame(function string) bool {
+	pkg := funcPkg(function)
+	return pkg == goomPkg || pkg == goomPkg+"/arg" || strings.HasPrefix(pkg, goomPkg+"/internal/") || pkg == "reflect"
+}
+
+// funcPkg 从调用栈的函数名中获取包路径, 比如 github.com/tencent/goom.(*Builder).Func 的包路径为 github.com/tencent/goom
+func funcPkg(function string) string {
+	// 泛型函数的类型参数中可能包含其他包路径, 比如 pkg.F[github.com/x.T]
+	if i := strings.IndexByte(function, '['); i >= 0 {
+		function = function[:i]
+	}
+	slash := strings.LastIndexByte(function, '/')
+	if dot := strings.IndexByte(function[slash+1:], '.'); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// mergeUsageFile 将使用情况合并到汇总文件, 相同的声明累加调用次数
+func mergeUsageFile(file string, usages []*Usage) error {
+	usageLock.Lock()
+	defer usageLock.Unlock()
+
+	merged := make(map[string]*Usage)
+	if data, err := os.ReadFile(file); err == nil {
+		var existing []*Usage
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("parse %s: %w", file, err)
+		}
+		for _, u := range existing {
+			merged[u.key()] = u
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, u := range usages {
+		if e, ok := merged[u.key()]; ok {
+			e.Hits += u.Hits
+			continue
+		}
+		c := *u
+		merged[u.key()] = &c
+	}
+
+	result := make([]*Usage, 0, len(merged))
+	for _, u := range merged {
+		result = append(result, u)
+	}
+	sortUsages(result)
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
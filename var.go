@@ -22,6 +22,7 @@ type defaultVarMocker struct {
 	mockValue   interface{}
 	originValue interface{}
 	canceled    bool // canceled 是否被取消
+	suspended   bool // suspended 是否被暂停
 }
 
 // String mock 的名称或描述, 方便调试和问题排查
@@ -5,7 +5,10 @@
 package mocker
 
 import (
+	"fmt"
 	"reflect"
+	"regexp"
+	"time"
 
 	"github.com/tencent/goom/arg"
 	"github.com/tencent/goom/erro"
@@ -32,6 +35,19 @@ type When struct {
 	defaultReturns Matcher
 	// curMatch 当前指定的参数匹配
 	curMatch Matcher
+	// partialReturn 是否允许只指定部分返回值, 未指定的返回值使用零值
+	partialReturn bool
+	// callerScoped 是否有条件指定了调用方
+	callerScoped bool
+	// callers 所有条件指定的调用方, 没有指定调用方的默认返回值只对这些调用方生效
+	callers []*regexp.Regexp
+	// replayPath 回放的 golden 文件路径, 没有匹配的录制调用时 panic
+	replayPath string
+}
+
+// partialReturner 支持部分返回值的 mocker
+type partialReturner interface {
+	allowPartialReturn() bool
 }
 
 // CreateWhen 构造条件判断
@@ -41,6 +57,11 @@ type When struct {
 func CreateWhen(m ExportedMocker, funcDef interface{}, args []interface{},
 	defaultReturns []interface{}, isMethod bool) (*When, error) {
 	impTyp := reflect.TypeOf(funcDef)
+	p, ok := m.(partialReturner)
+	partialReturn := ok && p.allowPartialReturn()
+	if partialReturn && defaultReturns != nil {
+		defaultReturns = fillZero(defaultReturns, impTyp)
+	}
 	err := checkParams(funcDef, impTyp, args, defaultReturns, isMethod)
 	if err != nil {
 		return nil, err
@@ -49,16 +70,17 @@ func CreateWhen(m ExportedMocker, funcDef interface{}, args []interface{},
 	var (
 		curMatch     Matcher
 		defaultMatch Matcher
+		name         = mockerName(m)
 	)
 	if defaultReturns != nil {
-		curMatch = newAlwaysMatch(defaultReturns, impTyp)
+		curMatch = newAlwaysMatch(name, defaultReturns, impTyp)
 	} else if len(outTypes(impTyp)) == 0 {
 		curMatch = newEmptyMatch()
 	}
 
 	defaultMatch = curMatch
 	if args != nil {
-		curMatch = newDefaultMatch(args, nil, isMethod, impTyp)
+		curMatch = newDefaultMatch(name, args, nil, isMethod, impTyp)
 	}
 	return &When{
 		ExportedMocker: m,
@@ -68,6 +90,7 @@ func CreateWhen(m ExportedMocker, funcDef interface{}, args []interface{},
 		isMethod:       isMethod,
 		matches:        make([]Matcher, 0),
 		curMatch:       curMatch,
+		partialReturn:  partialReturn,
 	}, nil
 }
 
@@ -107,7 +130,7 @@ func NewWhen(funTyp reflect.Type) *When {
 //	In(3, 4), // 第一个参数是 In
 //	Any()) // 第二个参数是 Any
 func (w *When) When(specArgOrExpr ...interface{}) *When {
-	w.curMatch = newDefaultMatch(specArgOrExpr, nil, w.isMethod, w.funcTyp)
+	w.curMatch = newDefaultMatch(w.name(), specArgOrExpr, nil, w.isMethod, w.funcTyp)
 	return w
 }
 
@@ -115,12 +138,13 @@ func (w *When) When(specArgOrExpr ...interface{}) *When {
 // 当参数为多个时, In 的每个条件各使用一个数组表示:
 // .In([]interface{}{3, Any()}, []interface{}{4, Any()})
 func (w *When) In(specArgsOrExprs ...interface{}) *When {
-	w.curMatch = newContainsMatch(specArgsOrExprs, nil, w.isMethod, w.funcTyp)
+	w.curMatch = newContainsMatch(w.name(), specArgsOrExprs, nil, w.isMethod, w.funcTyp)
 	return w
 }
 
 // Return 指定返回值
 func (w *When) Return(value ...interface{}) *When {
+	value = w.fillResults(value)
 	if w.curMatch != nil {
 		w.curMatch.AddResult(value)
 		w.matches = append(w.matches, w.curMatch)
@@ -128,7 +152,7 @@ func (w *When) Return(value ...interface{}) *When {
 	}
 
 	if w.defaultReturns == nil {
-		w.defaultReturns = newAlwaysMatch(value, w.funcTyp)
+		w.defaultReturns = newAlwaysMatch(w.name(), value, w.funcTyp)
 	} else {
 		w.defaultReturns.AddResult(value)
 	}
@@ -140,10 +164,23 @@ func (w *When) AndReturn(value ...interface{}) *When {
 	if w.curMatch == nil {
 		return w.Return(value...)
 	}
-	w.curMatch.AddResult(value)
+	w.curMatch.AddResult(w.fillResults(value))
 	return w
 }
 
+// ReturnZero 返回值全部使用零值
+func (w *When) ReturnZero() *When {
+	return w.Return(zeroResults(w.funcTyp)...)
+}
+
+// fillResults 允许部分返回值时, 使用零值补全未指定的返回值
+func (w *When) fillResults(value []interface{}) []interface{} {
+	if !w.partialReturn {
+		return value
+	}
+	return fillZero(value, w.funcTyp)
+}
+
 // Matches 多个条件匹配
 func (w *When) Matches(argAndRet ...arg.Pair) *When {
 	if len(argAndRet) == 0 {
@@ -159,9 +196,10 @@ func (w *When) Matches(argAndRet ...arg.Pair) *When {
 		if !ok {
 			results = []interface{}{v.Return}
 		}
+		results = w.fillResults(results)
 
 		w.Return(results...)
-		matcher := newDefaultMatch(args, results, w.isMethod, w.funcTyp)
+		matcher := newDefaultMatch(w.name(), args, results, w.isMethod, w.funcTyp)
 		w.matches = append(w.matches, matcher)
 	}
 	return w
@@ -187,32 +225,251 @@ func (w *When) Returns(values ...interface{}) *When {
 	return w
 }
 
+// SetArg 匹配成功时, 在返回结果前将 value 写入第 index 个(不含接收体)指针参数指向的值
+// 比如: When("key", arg.Any()).SetArg(1, Config{Name: "x"}).Return(nil)
+func (w *When) SetArg(index int, value interface{}) *When {
+	return w.addOutArg(arg.SetArg(index, value))
+}
+
+// SetArgField 匹配成功时, 在返回结果前将 value 写入第 index 个(不含接收体)指针参数指向的结构体的 field 属性
+// 比如: When("key", arg.Any()).SetArgField(1, "Name", "x").Return(nil)
+func (w *When) SetArgField(index int, field string, value interface{}) *When {
+	return w.addOutArg(arg.SetField(index, field, value))
+}
+
+// addOutArg 给当前的条件添加出参写入
+func (w *When) addOutArg(o *arg.OutArg) *When {
+	if err := o.Resolve(inTypes(w.isMethod, w.funcTyp)); err != nil {
+		panic("Call SetArg(...) error: " + err.Error())
+	}
+
+	m, ok := w.clauseTarget().(outArgMatcher)
+	if !ok {
+		panic("SetArg(...) must be called after When(...) or Return(...)")
+	}
+	m.addOutArg(o)
+	return w
+}
+
+// InState 当前的条件仅在状态处于 name 时匹配
+// builder 内只有一个状态时可以只指定状态值, 比如: When(1).InState("up").Return(3).Transition("down")
+// 也可以指定 *State 或者 builder 内的状态名称, 比如: When(1).InState("conn", "up"), When(1).InState(st, "up")
+func (w *When) InState(state interface{}, name ...string) *When {
+	m, ok := w.clauseTarget().(stateMatcher)
+	if !ok {
+		panic("InState(...) must be called after When(...) or Return(...)")
+	}
+	m.addInState(w.stateClause("InState", state, name))
+	return w
+}
+
+// Transition 当前的条件匹配成功后, 将状态迁移到 name, 状态的指定方式与 InState 相同
+// 比如: Transition("down"), Transition("conn", "down"), Transition(st, "down")
+func (w *When) Transition(state interface{}, name ...string) *When {
+	m, ok := w.clauseTarget().(stateMatcher)
+	if !ok {
+		panic("Transition(...) must be called after When(...) or Return(...)")
+	}
+	m.addTransition(w.stateClause("Transition", state, name))
+	return w
+}
+
+// stateClause 解析状态子句的参数
+// state 为 *State 或者 builder 内的状态名称; 未指定 name 时 state 为状态值, 使用 builder 内唯一的状态
+func (w *When) stateClause(api string, state interface{}, name []string) *stateClause {
+	if len(name) > 1 {
+		panic(api + "(...) accepts at most one state value")
+	}
+	var (
+		st        *State
+		stateName string
+	)
+	switch v := state.(type) {
+	case *State:
+		if len(name) == 0 {
+			panic(api + "(st, value) requires a state value")
+		}
+		st = v
+	case string:
+		if len(name) == 0 {
+			stateName, name = "", []string{v}
+		} else {
+			stateName = v
+		}
+		if o, ok := w.ExportedMocker.(stateOwner); ok {
+			st = o.lookupState(stateName)
+		}
+	default:
+		panic(api + "(...) state must be *State or state name")
+	}
+	if st == nil {
+		panic(api + "(...) state not found, create it with mock.State(name) first, " +
+			"or specify the state name when the builder has more than one state")
+	}
+	return &stateClause{state: st, name: name[0]}
+}
+
+// CalledFrom 当前的条件仅对来自指定调用方的调用生效, 调用栈中任意一帧的函数名匹配其中一个 pattern 即可
+// pattern 支持 * 通配符, 比如: When(arg.Any()).Return(nil).CalledFrom("github.com/us/svc/repo.*")
+// 来自其他调用方的调用没有匹配的条件时, 通过跳板函数直接调用原函数, 没有指定调用方的默认返回值也不生效
+// 需要对所有调用方生效的默认返回值可以显式指定, 比如: Return(0).CalledFrom("*")
+func (w *When) CalledFrom(patterns ...string) *When {
+	m, ok := w.clauseTarget().(callerMatcher)
+	if !ok || len(patterns) == 0 {
+		panic("CalledFrom(...) must be called after When(...) or Return(...) with at least one pattern")
+	}
+	o, ok := w.ExportedMocker.(originCaller)
+	if !ok {
+		panic("mocker [" + w.name() + "] does not support CalledFrom(...)")
+	}
+	o.ensureOrigin()
+	for _, p := range patterns {
+		pattern := globPattern(p)
+		m.addCaller(pattern)
+		w.callers = append(w.callers, pattern)
+	}
+	w.callerScoped = true
+	return w
+}
+
+// Delay 当前的条件匹配成功后, 延迟 d 再返回, 用于模拟慢调用
+// 比如: When(1).Return(3).Delay(100 * time.Millisecond)
+func (w *When) Delay(d time.Duration) *When {
+	w.effectTarget("Delay").setDelay(d)
+	return w
+}
+
+// Panic 当前的条件匹配成功后抛出 panic, 用于异常注入
+// 比如: When(-1).Panic("invalid arg")
+func (w *When) Panic(v interface{}) *When {
+	if v == nil {
+		panic("Panic(...) value must not be nil")
+	}
+	w.effectTarget("Panic").setPanic(v)
+	return w
+}
+
+// effectTarget 获取延迟和 panic 作用的匹配器, 未指定返回值时使用零值返回
+func (w *When) effectTarget(api string) effectMatcher {
+	if m, ok := w.clauseTarget().(effectMatcher); !ok || !m.hasResult() {
+		w.ReturnZero()
+	}
+	m, ok := w.clauseTarget().(effectMatcher)
+	if !ok {
+		panic(api + "(...) must be called after When(...) or Return(...)")
+	}
+	return m
+}
+
+// clauseTarget 获取子句作用的匹配器, 未指定条件时作用于默认返回值
+func (w *When) clauseTarget() Matcher {
+	if w.curMatch != nil {
+		return w.curMatch
+	}
+	return w.defaultReturns
+}
+
 // invoke 执行 When 参数匹配并返回值
 func (w *When) invoke(args1 []reflect.Value) (results []reflect.Value) {
+	var frames []string
+	if w.callerScoped {
+		frames = callerFrames()
+	}
 	if len(w.matches) != 0 {
 		for _, c := range w.matches {
-			if c.Match(args1) {
-				return c.Result()
+			if matchCaller(c, frames) && c.Match(args1) && enterMatcherState(c) {
+				return w.result(c, args1)
 			}
 		}
 	}
-	return w.returnDefaults()
+	if w.callerScoped && !w.defaultInScope(frames) {
+		return w.ExportedMocker.(originCaller).callOrigin(args1)
+	}
+	return w.returnDefaults(args1)
+}
+
+// defaultInScope 有条件指定了调用方时, 默认返回值是否对当前调用方生效
+// 默认返回值通过 CalledFrom 显式指定调用方时按照指定的调用方判断, 否则只对其他条件指定的调用方生效, 其他调用方调用原函数
+func (w *When) defaultInScope(frames []string) bool {
+	if w.defaultReturns == nil {
+		return false
+	}
+	if m, ok := w.defaultReturns.(callerMatcher); ok && m.hasCaller() {
+		return m.matchCaller(frames)
+	}
+	return matchFrames(w.callers, frames)
+}
+
+// result 获取匹配器的返回值, 并在返回前写入出参
+func (w *When) result(c Matcher, args []reflect.Value) []reflect.Value {
+	results := c.Result()
+	if m, ok := c.(usageMatcher); ok {
+		m.hit()
+	}
+	if m, ok := c.(effectMatcher); ok {
+		defer m.applyEffects()
+	}
+	if m, ok := c.(outArgMatcher); ok {
+		if w.isMethod {
+			args = args[1:]
+		}
+		if err := m.applyOutArgs(args); err != nil {
+			panic("SetArg(...) apply error: " + err.Error())
+		}
+	}
+	return results
 }
 
 // Eval 执行 when 子句
 func (w *When) Eval(args ...interface{}) []interface{} {
 	argVs, err := arg.I2V(args, inTypes(w.isMethod, w.funcTyp))
 	if err != nil {
-		panic("Call Eval(...) error: " + err.Error())
+		panic("Call Eval(...) error: " + withMocker(err, w.name(), "arg").Error())
 	}
 	resultVs := w.invoke(argVs)
 	return arg.V2I(resultVs, outTypes(w.funcTyp))
 }
 
 // returnDefaults 返回默认值
-func (w *When) returnDefaults() []reflect.Value {
+func (w *When) returnDefaults(args []reflect.Value) []reflect.Value {
+	if w.replayPath != "" {
+		panic(fmt.Sprintf("no call recorded in %s matches args [%s], record again with %s=1",
+			w.replayPath, arg.SprintV(args), RecordEnv))
+	}
 	if w.defaultReturns == nil && w.funcTyp.NumOut() != 0 {
 		panic("there is no suitable condition matched, or set default return with: mocker.Return(...)")
 	}
-	return w.defaultReturns.Result()
+	if w.defaultReturns != nil && !enterMatcherState(w.defaultReturns) {
+		panic("there is no suitable condition matched in current state, or set default return with: mocker.Return(...)")
+	}
+	return w.result(w.defaultReturns, args)
+}
+
+// matchCaller 判断匹配器是否满足调用方条件
+func matchCaller(c Matcher, frames []string) bool {
+	if m, ok := c.(callerMatcher); ok {
+		return m.matchCaller(frames)
+	}
+	return true
+}
+
+// enterMatcherState 判断匹配器是否满足状态条件, 满足时执行状态迁移
+func enterMatcherState(c Matcher) bool {
+	if m, ok := c.(stateMatcher); ok {
+		return m.enterState()
+	}
+	return true
+}
+
+// name 当前 mocker 的名称
+func (w *When) name() string {
+	return mockerName(w.ExportedMocker)
+}
+
+// mockerName 获取 mocker 的名称, 用于错误提示
+func mockerName(m Mocker) string {
+	if m == nil {
+		return ""
+	}
+	return m.String()
 }
@@ -3,12 +3,14 @@
 package mocker_test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
 	mocker "github.com/tencent/goom"
 	"github.com/tencent/goom/arg"
+	"github.com/tencent/goom/erro"
 )
 
 // TestUnitWhenTestSuite 测试入口
@@ -46,6 +48,16 @@ func complex1(Arg) *Result {
 	return &Result{0}
 }
 
+// load 通过指针参数回填结果的函数
+func load(string, *Result) error {
+	return nil
+}
+
+// unmarshal 通过 interface{} 参数回填结果的函数
+func unmarshal([]byte, interface{}) error {
+	return nil
+}
+
 // Struct for 结构体方法 When
 type Struct struct{}
 
@@ -200,6 +212,103 @@ func (s *WhenTestSuite) TestNil() {
 	})
 }
 
+// TestSetArg 测试出参写入
+func (s *WhenTestSuite) TestSetArg() {
+	s.Run("success", func() {
+		when := mocker.NewWhen(reflect.TypeOf(load))
+		when.When("a", arg.Any()).SetArg(1, Result{field1: 1}).Return(nil).
+			When("b", arg.Any()).SetArgField(1, "field1", 2).Return(nil).
+			When("c", arg.Any()).SetArg(1, &Result{field1: 3}).Return(nil)
+
+		r := &Result{}
+		when.Eval("a", r)
+		s.Equal(1, r.field1, "set arg check")
+		when.Eval("b", r)
+		s.Equal(2, r.field1, "set arg field check")
+		when.Eval("c", r)
+		s.Equal(3, r.field1, "set arg by pointer check")
+	})
+
+	s.Run("interface arg", func() {
+		when := mocker.NewWhen(reflect.TypeOf(unmarshal))
+		when.When(arg.Any(), arg.Any()).SetArgField(1, "field1", 5).Return(nil)
+
+		r := &Result{}
+		when.Eval([]byte("{}"), r)
+		s.Equal(5, r.field1, "set interface arg check")
+	})
+
+	s.Run("type not match", func() {
+		when := mocker.NewWhen(reflect.TypeOf(load))
+		s.Panics(func() {
+			when.When("a", arg.Any()).SetArg(0, "not a pointer")
+		}, "set arg type check")
+		s.Panics(func() {
+			when.When("a", arg.Any()).SetArgField(1, "notExists", 1)
+		}, "set arg field check")
+	})
+}
+
+// fakeResult 与 Result 内存布局相同的 fake 结构体
+type fakeResult struct {
+	value int
+}
+
+// size 返回 int64 的函数
+func size(string) int64 {
+	return 0
+}
+
+// TestValueConvert 测试参数和返回值的类型转换
+func (s *WhenTestSuite) TestValueConvert() {
+	s.Run("convertible", func() {
+		when := mocker.NewWhen(reflect.TypeOf(size))
+		when.When("a").Return(1).When("b").Return(int32(2))
+
+		s.Equal(int64(1), when.Eval("a")[0], "int to int64 check")
+		s.Equal(int64(2), when.Eval("b")[0], "int32 to int64 check")
+	})
+
+	s.Run("not convertible", func() {
+		when := mocker.NewWhen(reflect.TypeOf(size))
+		s.Contains(panicMessage(func() {
+			when.Return(1.5)
+		}), "return[0], required: int64, actual: float64", "float to int64 check")
+
+		when = mocker.NewWhen(reflect.TypeOf(complex))
+		s.Contains(panicMessage(func() {
+			when.Return(fakeResult{value: 1})
+		}), "required: mocker_test.Result, actual: mocker_test.fakeResult", "fake struct check")
+	})
+
+	s.Run("slice to array", func() {
+		_, err := arg.I2V([]interface{}{[]int{1}}, []reflect.Type{reflect.TypeOf([4]int{})})
+		s.IsType(&erro.ValueNotMatch{}, err, "short slice to array check")
+		_, err = arg.I2V([]interface{}{[]int{1}}, []reflect.Type{reflect.TypeOf(&[4]int{})})
+		s.IsType(&erro.ValueNotMatch{}, err, "short slice to array pointer check")
+
+		values, err := arg.I2V([]interface{}{[]int{1, 2}}, []reflect.Type{reflect.TypeOf([2]int{})})
+		s.NoError(err)
+		s.Equal([2]int{1, 2}, values[0].Interface(), "slice to array check")
+	})
+
+	s.Run("cast", func() {
+		when := mocker.NewWhen(reflect.TypeOf(complex))
+		when.Return(arg.Cast(fakeResult{value: 1}))
+
+		s.Equal(Result{field1: 1}, when.Eval(Arg{})[0], "cast fake struct check")
+	})
+}
+
+// panicMessage 获取 panic 的信息
+func panicMessage(f func()) (msg string) {
+	defer func() {
+		msg = fmt.Sprintf("%v", recover())
+	}()
+	f()
+	return ""
+}
+
 // TestMethodWhen 方法参数条件匹配
 func (s *WhenTestSuite) TestMethodWhen() {
 	s.Run("success", func() {